@@ -0,0 +1,99 @@
+package uzbl
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+
+	"honnef.co/go/uzbl/command"
+)
+
+// DialSocket connects to the control socket of a running uzbl-core,
+// as created with its --socket option. uzbl-core sends events to all
+// clients of the socket, so the connection can be used as
+// Options.Conn.
+func DialSocket(path string) (io.ReadWriteCloser, error) {
+	return net.Dial("unix", path)
+}
+
+type fifoConn struct {
+	io.Reader
+	fifo   *os.File
+	events io.Reader
+	pw     *io.PipeWriter
+}
+
+func (c *fifoConn) Write(b []byte) (int, error) {
+	return c.fifo.Write(b)
+}
+
+func (c *fifoConn) Close() error {
+	if c.pw != nil {
+		c.pw.Close()
+	}
+	if cl, ok := c.events.(io.Closer); ok {
+		cl.Close()
+	}
+	return c.fifo.Close()
+}
+
+// OpenFIFO opens the command FIFO of a running uzbl-core, as created
+// in its --fifo-dir. FIFOs only accept commands; events have to be
+// provided separately via events, for example by reading from a
+// socket that uzbl-core connects to. If events is nil, no events
+// will be received.
+func OpenFIFO(path string, events io.Reader) (io.ReadWriteCloser, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	c := &fifoConn{Reader: events, fifo: f, events: events}
+	if events == nil {
+		pr, pw := io.Pipe()
+		c.Reader, c.pw = pr, pw
+	}
+	return c, nil
+}
+
+// runAttached drives an instance of uzbl-core that was started by
+// someone else, via Options.Conn. The config isn't loaded, as the
+// instance is expected to have been configured already. Instead,
+// uzbl-core is asked to dump its config, which emits VARIABLE_SET for
+// all variables. Binds and on_event handlers only exist as events
+// that were emitted before attaching, so they are lost and have to be
+// defined again, for example by sending the relevant parts of the
+// config.
+func (u *Uzbl) runAttached(ctx context.Context) error {
+	conn := u.opts.Conn
+	w := newWriter(conn)
+	u.mu.Lock()
+	u.w = w
+	u.mu.Unlock()
+	defer w.close()
+
+	listening := make(chan struct{})
+	var err error
+	go func() {
+		err = u.em.Serve(conn)
+		close(listening)
+	}()
+	u.Exec(command.DumpConfigAsEvents())
+	reg := u.configureWhenLoaded()
+	defer reg.Remove()
+
+	select {
+	case <-listening:
+		conn.Close()
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	w.close()
+	conn.Close()
+	<-listening
+	return ctx.Err()
+}
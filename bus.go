@@ -0,0 +1,90 @@
+package uzbl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"honnef.co/go/uzbl/command"
+)
+
+// Broadcast emits the event name with detail in every instance
+// managed by the same Manager, including u itself. If u isn't
+// managed, the event is only emitted in u. The detail is passed on
+// literally, without performing any @ expansions.
+//
+// From the config, broadcasts can be sent with
+//
+//	event BROADCAST NAME detail
+func (u *Uzbl) Broadcast(name, detail string) error {
+	if u.manager == nil {
+		return u.Exec(command.RawEvent(name, command.NoExpand(detail)))
+	}
+	return u.manager.Broadcast(name, detail)
+}
+
+// Unicast emits the event name with detail in the instance with the
+// given ID, which must be managed by the same Manager as u. Like with
+// Broadcast, the detail is passed on literally.
+//
+// From the config, unicasts can be sent with
+//
+//	event UNICAST id NAME detail
+func (u *Uzbl) Unicast(id int, name, detail string) error {
+	if u.manager == nil {
+		return fmt.Errorf("instance isn't managed")
+	}
+	return u.manager.Unicast(id, name, detail)
+}
+
+// Broadcast emits the event name with detail in all instances. It
+// returns the first error encountered, but tries all instances.
+func (m *Manager) Broadcast(name, detail string) error {
+	var first error
+	for _, inst := range m.List() {
+		err := inst.Uzbl.Exec(command.RawEvent(name, command.NoExpand(detail)))
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Unicast emits the event name with detail in the instance with the
+// given ID.
+func (m *Manager) Unicast(id int, name, detail string) error {
+	inst := m.Get(id)
+	if inst == nil {
+		return fmt.Errorf("no instance with ID %d", id)
+	}
+	return inst.Uzbl.Exec(command.RawEvent(name, command.NoExpand(detail)))
+}
+
+func splitFirst(s string) (string, string) {
+	s = strings.TrimLeft(s, " ")
+	if idx := strings.Index(s, " "); idx >= 0 {
+		return s[:idx], s[idx+1:]
+	}
+	return s, ""
+}
+
+func (u *Uzbl) evBroadcast(ev *Event) error {
+	name, detail := splitFirst(ev.Detail)
+	if name == "" {
+		return fmt.Errorf("BROADCAST without event name")
+	}
+	return u.Broadcast(name, detail)
+}
+
+func (u *Uzbl) evUnicast(ev *Event) error {
+	sid, rest := splitFirst(ev.Detail)
+	name, detail := splitFirst(rest)
+	id, err := strconv.Atoi(sid)
+	if err != nil {
+		return fmt.Errorf("invalid instance ID in UNICAST: %s", err)
+	}
+	if name == "" {
+		return fmt.Errorf("UNICAST without event name")
+	}
+	return u.Unicast(id, name, detail)
+}
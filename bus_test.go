@@ -0,0 +1,28 @@
+package uzbl_test
+
+import (
+	"testing"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/uzbltest"
+)
+
+func TestBroadcastDoesNotExpand(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{})
+	var got []string
+	f.Uzbl.AddHandler("GREETING", func(ev *uzbl.Event) error {
+		got = append(got, ev.Detail)
+		return nil
+	})
+	f.Uzbl.Exec(command.Set("name", "secret"))
+	f.Sync()
+	f.Emit("BROADCAST", `GREETING 'hi @name @(rm -rf ~)@ \@x'`)
+	f.Sync()
+
+	// the escaped @ is unescaped by uzbl-core, but still not expanded
+	want := `'hi @name @(rm -rf ~)@ @x'`
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("got %q, want [%q]", got, want)
+	}
+}
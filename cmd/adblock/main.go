@@ -13,7 +13,9 @@ import (
 	"time"
 
 	"honnef.co/go/uzbl/adblock"
+	"honnef.co/go/uzbl/command"
 	"honnef.co/go/uzbl/event_manager"
+	"honnef.co/go/uzbl/event_manager/events"
 )
 
 type logger bool
@@ -140,15 +142,17 @@ and append a file to the generated stylesheet.`)
 
 func runBlocker(b *blocker) {
 	em := event_manager.New(b.c)
-	em.AddHandler("REQUEST-ADBLOCK", b.evPolicyRequest)
-	em.AddHandler("LOAD_COMMIT", b.evLoadCommit)
-	em.AddHandler("NAVIGATION_STARTING", b.evNavigationStarting)
+	events.OnRequest(em, "ADBLOCK", b.evPolicyRequest)
+	events.OnLoadCommit(em, b.evLoadCommit)
+	events.OnNavigationStarting(em, b.evNavigationStarting)
 	em.Listen()
 }
 
-func (b *blocker) evPolicyRequest(ev *event_manager.Event) error {
-	args := ev.ParseDetail(4)
-	uri, frame := args[0], args[2]
+func (b *blocker) evPolicyRequest(req events.Request) error {
+	if len(req.Args) < 3 {
+		return fmt.Errorf("malformed ADBLOCK request: %q", req.Args)
+	}
+	uri, frame := req.Args[0], req.Args[2]
 	t1 := time.Now()
 	_, matches := b.ab.Match(b.curDomains[frame], uri)
 	t2 := time.Now()
@@ -159,16 +163,14 @@ func (b *blocker) evPolicyRequest(ev *event_manager.Event) error {
 		logging.Println("Took", t2.Sub(t1), "to filter (no match)", uri)
 	}
 
-	fmt.Fprintf(b.c, "REPLY-%s %s\n", ev.Cookie, uri)
+	fmt.Fprintf(b.c, "REPLY-%s %s\n", req.Cookie, uri)
 	return nil
 }
 
-func (b *blocker) evLoadCommit(ev *event_manager.Event) error {
-	args := ev.ParseDetail(1)
-
+func (b *blocker) evLoadCommit(l events.Load) error {
 	b.curDomains = make(map[string]string)
 
-	u, err := url.Parse(args[0][1 : len(args[0])-1])
+	u, err := url.Parse(l.URI)
 	if err != nil {
 		return fmt.Errorf("error parsing host: %s", err)
 	}
@@ -202,14 +204,12 @@ func (b *blocker) evLoadCommit(ev *event_manager.Event) error {
 		io.Copy(f, f2)
 	}
 
-	fmt.Fprintln(b.c, "css clear")
-	fmt.Fprintln(b.c, "css add file://"+fAdStylesheet)
+	fmt.Fprintln(b.c, command.CSSClear())
+	fmt.Fprintln(b.c, command.CSSAdd("file://"+fAdStylesheet))
 	return nil
 }
 
-func (b *blocker) evNavigationStarting(ev *event_manager.Event) error {
-	args := ev.ParseDetail(4)
-	uri, frame := args[0], args[1]
-	b.curDomains[frame] = uri
+func (b *blocker) evNavigationStarting(nav events.NavigationStarting) error {
+	b.curDomains[nav.Frame] = nav.URI
 	return nil
 }
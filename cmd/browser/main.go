@@ -1,18 +1,56 @@
 package main // import "honnef.co/go/uzbl/browser"
 
 import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/event_manager"
 	"honnef.co/go/uzbl/follow"
 	"honnef.co/go/uzbl/progress"
 	"honnef.co/go/uzbl/scroll"
 )
 
 func main() {
-	u := &uzbl.Uzbl{}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var fAttach, fTrace string
+	flag.StringVar(&fAttach, "attach", "", "Attach to the uzbl-core listening on this socket instead of starting one")
+	flag.StringVar(&fTrace, "trace", "", "Record all events to this file")
+	flag.Parse()
+
+	opts := uzbl.Options{
+		URI:        "https://google.com",
+		Middleware: []event_manager.Middleware{event_manager.Recover},
+	}
+	if fAttach != "" {
+		conn, err := uzbl.DialSocket(fAttach)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Conn = conn
+	}
+	if fTrace != "" {
+		f, err := os.Create(fTrace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		opts.Trace = f
+	}
+
+	u := uzbl.New(opts)
 	u.Register(
 		&progress.Bar{},
 		&scroll.Indicator{},
 		&follow.Follow{},
 	)
-	u.Start()
+	if err := u.Run(ctx); err != nil && err != context.Canceled {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,253 @@
+package main // import "honnef.co/go/uzbl/cmd/uzbl-em"
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/follow"
+	"honnef.co/go/uzbl/progress"
+	"honnef.co/go/uzbl/scroll"
+)
+
+type logger bool
+
+func (l logger) Println(v ...interface{}) {
+	if l {
+		log.Println(v...)
+	}
+}
+
+func (l logger) Printf(format string, v ...interface{}) {
+	if l {
+		log.Printf(format, v...)
+	}
+}
+
+var logging logger
+
+var (
+	fSocket  string
+	fVerbose bool
+)
+
+func plugins() []uzbl.Registerable {
+	return []uzbl.Registerable{
+		&progress.Bar{},
+		&scroll.Indicator{},
+		&follow.Follow{},
+	}
+}
+
+// instanceConn is the connection of a single uzbl-core instance.
+// Events are demultiplexed from the shared connection into the
+// pipe, while commands are written to the shared connection
+// directly.
+type instanceConn struct {
+	*io.PipeReader
+	w io.Writer
+}
+
+func (c instanceConn) Write(b []byte) (int, error) {
+	return c.w.Write(b)
+}
+
+type instance struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+}
+
+type connection struct {
+	ctx       context.Context
+	c         net.Conn
+	mu        sync.Mutex
+	instances map[int]*instance
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`This program is an event manager for uzbl-core. It listens on a
+socket that any number of uzbl-core instances can connect to and
+runs a separate set of plugins for every instance.
+
+Start uzbl-core with
+
+    uzbl-core --connect-socket=/path/to/socket
+
+to connect it to uzbl-em.`)
+		fmt.Fprintf(os.Stderr, "\nUsage: %s [-verbose] -socket socket\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.StringVar(&fSocket, "socket", "", "The socket to create and listen on")
+	flag.BoolVar(&fVerbose, "verbose", false, "Enable verbose output")
+	flag.Parse()
+
+	if fSocket == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	logging = logger(fVerbose)
+
+	addr, err := net.ResolveUnixAddr("unix", fSocket)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not parse socket address:", err)
+		os.Exit(2)
+	}
+
+	l, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Could not open socket:", err)
+		os.Exit(3)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ch
+		cancel()
+		l.Close()
+	}()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			fmt.Fprintln(os.Stderr, "Error in Accept():", err)
+			os.Exit(4)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn := &connection{ctx: ctx, c: c, instances: make(map[int]*instance)}
+			conn.serve()
+		}()
+	}
+	wg.Wait()
+}
+
+// pid extracts the PID from an event line of the form
+// EVENT [pid] NAME detail.
+func pid(line string) (int, bool) {
+	start := strings.Index(line, "[")
+	end := strings.Index(line, "]")
+	if start < 0 || end < start {
+		return 0, false
+	}
+	n, err := strconv.Atoi(line[start+1 : end])
+	return n, err == nil
+}
+
+func isInstanceExit(line string) bool {
+	idx := strings.Index(line, "] ")
+	return idx >= 0 && strings.HasPrefix(line[idx+2:], "INSTANCE_EXIT")
+}
+
+func (conn *connection) serve() {
+	logging.Println("New connection")
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-conn.ctx.Done():
+			conn.c.Close()
+		case <-stop:
+		}
+	}()
+
+	r := bufio.NewReader(conn.c)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		pid, ok := pid(line)
+		if !ok {
+			continue
+		}
+		inst := conn.instance(pid)
+		inst.pw.Write([]byte(line))
+		if isInstanceExit(line) {
+			conn.remove(pid)
+		}
+	}
+
+	conn.mu.Lock()
+	for pid := range conn.instances {
+		conn.instances[pid].pw.Close()
+	}
+	conn.mu.Unlock()
+	for _, inst := range conn.snapshot() {
+		<-inst.done
+	}
+	conn.c.Close()
+	logging.Println("Connection closed")
+}
+
+func (conn *connection) snapshot() []*instance {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	var out []*instance
+	for _, inst := range conn.instances {
+		out = append(out, inst)
+	}
+	return out
+}
+
+// instance returns the instance for pid, starting a new set of
+// plugins if it doesn't exist yet.
+func (conn *connection) instance(pid int) *instance {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if inst, ok := conn.instances[pid]; ok {
+		return inst
+	}
+
+	logging.Printf("New instance %d", pid)
+	pr, pw := io.Pipe()
+	inst := &instance{pw: pw, done: make(chan struct{})}
+	conn.instances[pid] = inst
+
+	u := uzbl.New(uzbl.Options{Conn: instanceConn{pr, conn.c}})
+	u.Register(plugins()...)
+	go func() {
+		defer close(inst.done)
+		err := u.Run(conn.ctx)
+		// Nothing reads the pipe anymore, even if Run failed before
+		// attaching, so further events for this instance must not
+		// block the connection.
+		pr.CloseWithError(err)
+		if err != nil && err != context.Canceled {
+			log.Printf("Instance %d: %s", pid, err)
+		}
+		logging.Printf("Instance %d exited", pid)
+	}()
+	return inst
+}
+
+// remove shuts down the plugins of an instance that has exited.
+func (conn *connection) remove(pid int) {
+	conn.mu.Lock()
+	inst, ok := conn.instances[pid]
+	delete(conn.instances, pid)
+	conn.mu.Unlock()
+	if ok {
+		inst.pw.Close()
+	}
+}
@@ -0,0 +1,225 @@
+package main // import "honnef.co/go/uzbl/cmd/uzbl-lint"
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/adblock"
+	"honnef.co/go/uzbl/config"
+)
+
+var knownCommands = map[string]bool{}
+
+func init() {
+	for _, cmd := range strings.Fields(`
+		add_cookie auth back cache chain clear_cookies cookie css
+		dehilight delete_cookie download dump_config
+		dump_config_as_events event exit favicon forward frame
+		geometry hardcopy include inspector js load menu menu_add
+		menu_editable_add menu_editable_remove menu_editable_separator
+		menu_image_add menu_image_remove menu_image_separator
+		menu_link_add menu_link_remove menu_link_separator menu_remove
+		menu_separator plugin print reload reload_ign_cache remove_all_db
+		request save script scroll search search_clear search_reverse
+		security set sh show_inspector snapshot spawn spell_checker stop
+		sync_sh sync_spawn talk_to_socket toggle toggle_status
+		toggle_zoom_type uri zoom zoom_in zoom_out`) {
+		knownCommands[cmd] = true
+	}
+}
+
+var knownVars = map[string]bool{}
+
+func init() {
+	for _, v := range strings.Fields(`
+		uri verbose print_events inject_html geometry show_status
+		status_top status_format status_format_right status_background
+		status_message title_format_long title_format_short icon
+		forward_keys useragent accept_languages zoom_level zoom_type
+		font_size monospace_size minimum_font_size default_encoding
+		enable_plugins enable_scripts javascript_windows autoload_images
+		autoshrink_images enable_spellcheck enable_private resizable_text_areas
+		stylesheet_uri print_backgrounds enforce_96_dpi caret_browsing
+		fifo_dir socket_dir scheme_handler request_handler download_handler
+		authentication_handler cookie_handler new_window load_finish_handler
+		load_start_handler max_conns max_conns_host http_debug proxy_url
+		ssl_ca_file ssl_verify cookie_policy default_font_family
+		maintain_history
+		keycmd keycmd_prompt mode_indicator scroll_message progress.output
+		TITLE SELECTED_URI NAME PID SOCKET FIFO ARCH_UZBL COMMIT
+		WEBKIT_MAJOR WEBKIT_MINOR WEBKIT_MICRO`) {
+		knownVars[v] = true
+	}
+}
+
+// reVarRef matches @var and @{var} references, ignoring escaped @
+// and the @<js>@, @(shell)@ and @[xml]@ expansions.
+var reVarRef = regexp.MustCompile(`(^|[^\\])@(?:\{([A-Za-z0-9_.]+)\}|([A-Za-z_][A-Za-z0-9_.]*))`)
+
+type linter struct {
+	out      io.Writer
+	vars     map[string]bool
+	problems int
+}
+
+func (l *linter) report(pos fmt.Stringer, format string, args ...interface{}) {
+	l.problems++
+	fmt.Fprintf(l.out, "%s: %s\n", pos, fmt.Sprintf(format, args...))
+}
+
+func (l *linter) fail(err error) {
+	l.problems++
+	fmt.Fprintln(l.out, err)
+}
+
+func (l *linter) checkCommand(pos config.Position, cmd string) {
+	name := strings.Fields(cmd)
+	if len(name) == 0 {
+		return
+	}
+	if strings.HasPrefix(name[0], "@") {
+		// aliases are checked as variable references
+		return
+	}
+	if !knownCommands[name[0]] {
+		l.report(pos, "unknown command '%s'", name[0])
+	}
+}
+
+func (l *linter) checkRefs(pos config.Position, s string) {
+	for _, m := range reVarRef.FindAllStringSubmatch(s, -1) {
+		name := m[2]
+		if name == "" {
+			name = m[3]
+		}
+		if !l.vars[name] {
+			l.report(pos, "reference to undefined variable '@%s'", name)
+		}
+	}
+}
+
+func (l *linter) lintConfig(path string) {
+	f, err := config.Load(path)
+	if err != nil {
+		l.fail(err)
+		return
+	}
+	// malformed lines are kept as commands, so their errors can be
+	// reported in order along with the other problems
+	parseErrors := make(map[config.Position][]*config.Error)
+	for _, err := range f.Errors {
+		parseErrors[err.Pos] = append(parseErrors[err.Pos], err)
+	}
+
+	l.vars = make(map[string]bool)
+	for v := range knownVars {
+		l.vars[v] = true
+	}
+	for _, n := range f.Nodes {
+		if set, ok := n.(*config.Set); ok {
+			l.vars[set.Name] = true
+		}
+	}
+
+	for _, n := range f.Nodes {
+		pos := n.Pos()
+		for _, err := range parseErrors[pos] {
+			l.report(pos, "%s", err.Msg)
+		}
+		switch n := n.(type) {
+		case *config.Set:
+			l.checkRefs(pos, n.Value)
+		case *config.OnEvent:
+			l.checkRefs(pos, n.Command)
+			l.checkCommand(pos, n.Command)
+		case *config.Bind:
+			l.checkRefs(pos, n.Command)
+			l.checkBind(pos, n.Keys)
+			l.checkCommand(pos, n.Command)
+		case *config.ModeBind:
+			l.checkRefs(pos, n.Command)
+			l.checkBind(pos, n.Keys)
+			l.checkCommand(pos, n.Command)
+		case *config.Command:
+			l.checkRefs(pos, n.Args)
+			l.checkCommand(pos, n.Name)
+		}
+	}
+}
+
+func (l *linter) checkBind(pos config.Position, keys string) {
+	if err := uzbl.ValidateBind(keys); err != nil {
+		l.report(pos, "%s", err)
+	}
+}
+
+func (l *linter) lintFilters(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		l.fail(err)
+		return
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '!' || text[0] == '[' {
+			continue
+		}
+		if adblock.Parse(text) == nil {
+			l.report(config.Position{Filename: path, Line: line}, "unsupported filter rule '%s' will be ignored", text)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		l.fail(err)
+	}
+}
+
+func main() {
+	var fFilters bool
+	var fVars string
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr,
+			`uzbl-lint checks uzbl config files for unknown commands, malformed
+binds and references to undefined variables. With -filters, the
+files are checked as Adblock Plus filter lists instead, reporting
+rules that the adblock package does not support.`)
+		fmt.Fprintf(os.Stderr, "\nUsage: %s [-filters] [-vars var1,var2] files...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.BoolVar(&fFilters, "filters", false, "Check Adblock Plus filter lists instead of configs")
+	flag.StringVar(&fVars, "vars", "", "Comma-separated list of additional variables to consider defined")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	for _, v := range strings.Split(fVars, ",") {
+		if v != "" {
+			knownVars[v] = true
+		}
+	}
+
+	l := &linter{out: os.Stdout}
+	for _, path := range flag.Args() {
+		if fFilters {
+			l.lintFilters(path)
+		} else {
+			l.lintConfig(path)
+		}
+	}
+	if l.problems > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func lint(t *testing.T, src string) []string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	l := &linter{out: &out}
+	l.lintConfig(path)
+	var problems []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line != "" {
+			problems = append(problems, strings.TrimPrefix(line, path+":"))
+		}
+	}
+	if len(problems) != l.problems {
+		t.Fatalf("counted %d problems, printed %d", l.problems, len(problems))
+	}
+	return problems
+}
+
+func TestLintConfig(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"set home_page = http://example.com/\n@bind h = uri @home_page\n", nil},
+		{"@bind C-< = back\n@bind S-> = forward\n", nil},
+		{"@bind o = uri %s\n@on_event LOAD_FINISH set status_message done\n", nil},
+		{"frobnicate\n", []string{"1: unknown command 'frobnicate'"}},
+		{"@bind x = uri @nowhere\n", []string{"1: reference to undefined variable '@nowhere'"}},
+		{"@bind x = uri \\@nowhere\n", nil},
+		{"@bind X-x = back\n", []string{"1: bind 'X-x': unknown modifier 'X'"}},
+		{"set\n@bind 'x\n", []string{"1: ", "2: "}},
+	}
+	for _, tt := range tests {
+		got := lint(t, tt.src)
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.src, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !strings.HasPrefix(got[i], tt.want[i]) {
+				t.Errorf("%q: got %q, want %q", tt.src, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package uzbl
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"honnef.co/go/uzbl/event_manager"
+)
+
+// maxPending is the number of sent commands remembered for
+// attributing COMMAND_ERROR events.
+const maxPending = 128
+
+// CommandError is an error reported by uzbl-core for a command that
+// was sent to it.
+type CommandError struct {
+	// Command is the command as it was sent. It is empty if the
+	// error couldn't be attributed to a command.
+	Command string
+	// Source is the plugin that sent the command, or empty if it
+	// wasn't sent by a plugin.
+	Source string
+	// Message is the error reported by uzbl-core.
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	if e.Command == "" {
+		return fmt.Sprintf("uzbl-core reported an error: %s", e.Message)
+	}
+	source := e.Source
+	if source == "" {
+		source = "unknown source"
+	}
+	return fmt.Sprintf("command '%s' (sent by %s) failed: %s", e.Command, source, e.Message)
+}
+
+type pendingCommand struct {
+	name   string
+	cmd    string
+	source string
+}
+
+func commandName(cmd string) string {
+	if idx := strings.IndexAny(cmd, " \t"); idx >= 0 {
+		return cmd[:idx]
+	}
+	return cmd
+}
+
+func (u *Uzbl) addPending(source, cmd string) pendingCommand {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.pending) == maxPending {
+		copy(u.pending, u.pending[1:])
+		u.pending = u.pending[:maxPending-1]
+	}
+	p := pendingCommand{commandName(cmd), cmd, source}
+	u.pending = append(u.pending, p)
+	return p
+}
+
+// removePending removes the newest pending command equal to p, for
+// commands that couldn't be sent after all.
+func (u *Uzbl) removePending(p pendingCommand) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i := len(u.pending) - 1; i >= 0; i-- {
+		if u.pending[i] == p {
+			u.pending = append(u.pending[:i], u.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// popPending removes and returns the oldest pending command called
+// name.
+func (u *Uzbl) popPending(name string) (pendingCommand, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i, p := range u.pending {
+		if p.name == name {
+			u.pending = append(u.pending[:i], u.pending[i+1:]...)
+			return p, true
+		}
+	}
+	return pendingCommand{}, false
+}
+
+func (u *Uzbl) evCommandExecuted(ev *event_manager.Event) error {
+	u.popPending(ev.ParseDetail(1)[0])
+	return nil
+}
+
+// evCommandError attributes errors to the oldest pending command of
+// the same name. Since uzbl-core doesn't tell us which line caused
+// the error, this is a best effort.
+func (u *Uzbl) evCommandError(ev *event_manager.Event) error {
+	msg := ev.ParseDetail(1)[0]
+	cerr := &CommandError{Message: msg}
+	if p, ok := u.popPending(commandName(msg)); ok {
+		cerr.Command = p.cmd
+		cerr.Source = p.source
+	}
+	if u.opts.OnCommandError != nil {
+		u.opts.OnCommandError(cerr)
+		return nil
+	}
+	log.Println(cerr)
+	return nil
+}
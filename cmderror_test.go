@@ -0,0 +1,38 @@
+package uzbl_test
+
+import (
+	"testing"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/uzbltest"
+)
+
+type bogusPlugin struct{}
+
+func (bogusPlugin) Name() string { return "bogus" }
+
+func (bogusPlugin) Init(u *uzbl.Uzbl) {
+	u.AddHandler("TRIGGER", func(ev *uzbl.Event) error {
+		ev.Exec(command.Raw("bogus_cmd x"))
+		return nil
+	})
+}
+
+func TestCommandErrorSource(t *testing.T) {
+	var errs []*uzbl.CommandError
+	opts := uzbl.Options{OnCommandError: func(err *uzbl.CommandError) {
+		errs = append(errs, err)
+	}}
+	f := uzbltest.New(t, opts, bogusPlugin{})
+	f.Emit("TRIGGER", "")
+	f.ExpectCommand("bogus_cmd x")
+	f.Emit("COMMAND_ERROR", "'bogus_cmd x'")
+
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors, want 1", len(errs))
+	}
+	if errs[0].Command != "bogus_cmd x" || errs[0].Source != "bogus" {
+		t.Errorf("got command %q from %q, want %q from %q", errs[0].Command, errs[0].Source, "bogus_cmd x", "bogus")
+	}
+}
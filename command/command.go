@@ -0,0 +1,217 @@
+// Package command builds uzbl commands, taking care of quoting and
+// escaping arguments.
+package command // import "honnef.co/go/uzbl/command"
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Command is a single line that can be sent to uzbl-core.
+type Command string
+
+func (c Command) String() string {
+	return string(c)
+}
+
+// Quote quotes s so that it is parsed as a single argument. It does
+// not prevent uzbl's @ expansions, but escapes an @ that would open
+// an expansion that is never closed. Quote is the inverse of Split.
+func Quote(s string) string {
+	s = oneLine(s)
+	if s != "" && !needsQuote(s) {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\', '\'':
+			b.WriteByte('\\')
+		case '@':
+			_, _, end, ok := expansion(s, i)
+			if ok {
+				b.WriteString(s[i:end])
+				i = end - 1
+				continue
+			}
+			if end < 0 {
+				b.WriteByte('\\')
+			}
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+func needsQuote(s string) bool {
+	if strings.ContainsAny(s, " \t'\"\\") {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '@' {
+			if _, _, end, _ := expansion(s, i); end < 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Literal is like Quote, but also escapes every @, so that s is
+// passed on verbatim, without any expansions. Use it for arguments
+// that come from untrusted sources.
+func Literal(s string) string {
+	s = oneLine(s)
+	if s != "" && !strings.ContainsAny(s, " \t'\"\\@") {
+		return s
+	}
+	return "'" + literalQuoter.Replace(s) + "'"
+}
+
+var literalQuoter = strings.NewReplacer(
+	`\`, `\\`,
+	`'`, `\'`,
+	`@`, `\@`,
+)
+
+var escaper = strings.NewReplacer(
+	`\`, `\\`,
+	`@`, `\@`,
+	`'`, `\'`,
+	`"`, `\"`,
+	" ", `\ `,
+	"\t", "\\\t",
+	"\n", `\ `,
+	"\r", `\ `,
+)
+
+// Escape escapes s for use as a free-form argument, such as the
+// value of set, so that it is taken literally: whitespace is
+// preserved and no @ expansions take place. Since commands can't
+// span multiple lines, newlines are replaced with spaces.
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// NoExpand escapes every @ in s that isn't escaped yet, so that
+// uzbl-core doesn't perform any expansions. All other characters,
+// including escapes, are kept, which makes it suitable for text that
+// is passed on as is, such as event details that have already been
+// expanded once.
+func NoExpand(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			b.WriteByte(c)
+			i++
+			b.WriteByte(s[i])
+		case c == '@':
+			b.WriteString(`\@`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// JSString returns s as a JavaScript string literal.
+func JSString(s string) string {
+	// json.Marshal escapes <, > and &, which means the result can
+	// also safely be used inside @<...>@ expansions.
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+}
+
+func join(name string, args ...string) Command {
+	if len(args) == 0 {
+		return Command(name)
+	}
+	return Command(name + " " + strings.Join(args, " "))
+}
+
+func literalAll(args []string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = Literal(arg)
+	}
+	return out
+}
+
+// Raw returns s as a command without any quoting or escaping.
+// uzbl-core performs all expansions in s; to build a command that
+// uses expansions in some of its arguments, quote them with Quote.
+func Raw(s string) Command {
+	return Command(oneLine(s))
+}
+
+// Set sets the variable name to value.
+func Set(name, value string) Command {
+	if value == "" {
+		return join("set", name)
+	}
+	return join("set", name, Escape(value))
+}
+
+// JS runs script in the given context, e.g. "page". @ expansions
+// in script are prevented.
+func JS(context, script string) Command {
+	return join("js", context, "string", NoExpand(oneLine(script)))
+}
+
+// JSFile runs the script at path in the given context.
+func JSFile(context, path string) Command {
+	return join("js", context, "file", Escape(path))
+}
+
+// CSSAdd adds the user stylesheet at uri.
+func CSSAdd(uri string) Command {
+	return join("css", "add", Escape(uri))
+}
+
+// CSSClear removes all user stylesheets.
+func CSSClear() Command {
+	return "css clear"
+}
+
+// URI loads uri.
+func URI(uri string) Command {
+	return join("uri", Escape(uri))
+}
+
+// Event emits the event name, with args as its quoted details. No
+// expansions are performed in args.
+func Event(name string, args ...string) Command {
+	return join("event", append([]string{name}, literalAll(args)...)...)
+}
+
+// RawEvent emits the event name with detail as is, without quoting.
+// uzbl-core performs any expansions in detail.
+func RawEvent(name, detail string) Command {
+	if detail == "" {
+		return join("event", name)
+	}
+	return join("event", name, oneLine(detail))
+}
+
+// Spawn runs the program at path with args, asynchronously. No
+// expansions are performed in path or args.
+func Spawn(path string, args ...string) Command {
+	return join("spawn", append([]string{Literal(path)}, literalAll(args)...)...)
+}
+
+func Back() Command               { return "back" }
+func Forward() Command            { return "forward" }
+func Reload() Command             { return "reload" }
+func ReloadIgnoreCache() Command  { return "reload_ign_cache" }
+func Stop() Command               { return "stop" }
+func Exit() Command               { return "exit" }
+func DumpConfigAsEvents() Command { return "dump_config_as_events" }
@@ -0,0 +1,25 @@
+package command
+
+import "testing"
+
+func TestBuildersPreventExpansions(t *testing.T) {
+	tests := []struct {
+		got  Command
+		want Command
+	}{
+		{Event("X", "@(rm -rf ~)@"), `event X '\@(rm -rf ~)\@'`},
+		{Event("X", "a", "@uri"), `event X a '\@uri'`},
+		{Event("X", "it's"), `event X 'it\'s'`},
+		{Spawn("/bin/echo", "@<alert(1)>@"), `spawn /bin/echo '\@<alert(1)>\@'`},
+		{JS("page", `alert("@TITLE")`), `js page string alert("\@TITLE")`},
+		{Set("title", "@(id)@"), `set title \@(id)\@`},
+		{URI("http://example.com/@foo"), `uri http://example.com/\@foo`},
+		{RawEvent("X", "@uri"), `event X @uri`},
+		{Raw("event X " + Quote("@uri")), `event X @uri`},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %s, want %s", tt.got, tt.want)
+		}
+	}
+}
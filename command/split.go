@@ -0,0 +1,230 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+)
+
+type ErrSyntax struct {
+	Offset int
+	Msg    string
+}
+
+func (e ErrSyntax) Error() string {
+	return fmt.Sprintf("Syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+type ExpansionKind int
+
+const (
+	// ExpandVar is @name or @{name}.
+	ExpandVar ExpansionKind = iota
+	// ExpandJS is @<script>@.
+	ExpandJS
+	// ExpandShell is @(command)@.
+	ExpandShell
+	// ExpandEscape is @[text]@, which escapes text for use in
+	// markup.
+	ExpandEscape
+)
+
+// Expansion describes an @ expansion in an argument. Expansions are
+// performed by uzbl-core, not by Split; Start and End are byte
+// offsets of the unexpanded text in the argument's Value.
+type Expansion struct {
+	Kind  ExpansionKind
+	Start int
+	End   int
+	// Expr is the variable name, script, command or text.
+	Expr string
+}
+
+// Arg is a single argument, with quotes and escapes removed.
+type Arg struct {
+	Value      string
+	Expansions []Expansion
+}
+
+// Split splits s into arguments following uzbl's grammar:
+// arguments are separated by spaces and tabs, single and double
+// quotes group text, and a backslash makes the next character
+// literal, both inside and outside of quotes. Expansions are copied
+// into the argument as is, without interpreting quotes or escapes
+// inside of them; \@ prevents an expansion.
+//
+// Unterminated quotes and expansions and trailing backslashes are
+// errors. For any s without newlines, Split(Quote(s)) returns a
+// single argument with Value s. Split(Literal(s)) and, for non-empty
+// s, Split(Escape(s)) do the same, without any expansions.
+func Split(s string) ([]Arg, error) {
+	return split(s, true)
+}
+
+// SplitLiteral is like Split, but doesn't treat @ specially. It is
+// meant for event details, which have already been expanded.
+func SplitLiteral(s string) ([]string, error) {
+	args, err := split(s, false)
+	return Values(args), err
+}
+
+// Values returns the values of args.
+func Values(args []Arg) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = arg.Value
+	}
+	return out
+}
+
+// split returns the arguments parsed so far together with any
+// error, so that callers can make a best effort on malformed input.
+func split(s string, expand bool) ([]Arg, error) {
+	var out []Arg
+	var cur Arg
+	var buf strings.Builder
+	inArg := false
+	var delim byte
+	quoteStart := 0
+
+	flush := func() {
+		cur.Value = buf.String()
+		out = append(out, cur)
+		cur = Arg{}
+		buf.Reset()
+		inArg = false
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			if i+1 == len(s) {
+				if inArg {
+					flush()
+				}
+				return out, ErrSyntax{i, "trailing backslash"}
+			}
+			i++
+			buf.WriteByte(s[i])
+			inArg = true
+		case c == '@' && expand:
+			kind, expr, end, ok := expansion(s, i)
+			if end < 0 {
+				if inArg {
+					flush()
+				}
+				return out, ErrSyntax{i, fmt.Sprintf("unterminated expansion %s", s[i:i+2])}
+			}
+			if ok {
+				start := buf.Len()
+				buf.WriteString(s[i:end])
+				cur.Expansions = append(cur.Expansions, Expansion{kind, start, buf.Len(), expr})
+				i = end - 1
+			} else {
+				buf.WriteByte(c)
+			}
+			inArg = true
+		case delim != 0:
+			if c == delim {
+				delim = 0
+			} else {
+				buf.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			delim = c
+			quoteStart = i
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				flush()
+			}
+		default:
+			buf.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		flush()
+	}
+	if delim != 0 {
+		return out, ErrSyntax{quoteStart, fmt.Sprintf("unterminated %c quote", delim)}
+	}
+	return out, nil
+}
+
+var closers = map[byte]string{
+	'<': ">@",
+	'(': ")@",
+	'[': "]@",
+	'{': "}",
+}
+
+var openerKinds = map[byte]ExpansionKind{
+	'<': ExpandJS,
+	'(': ExpandShell,
+	'[': ExpandEscape,
+	'{': ExpandVar,
+}
+
+func isVarChar(c byte) bool {
+	return c == '_' || c == '.' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// expansion inspects the @ at s[i]. It returns the end of the
+// expansion and ok == true if there is one, ok == false if the @ is
+// literal, and end == -1 if an expansion is opened but never
+// closed.
+func expansion(s string, i int) (kind ExpansionKind, expr string, end int, ok bool) {
+	if i+1 == len(s) {
+		return 0, "", i + 1, false
+	}
+	c := s[i+1]
+	if closer, found := closers[c]; found {
+		idx := strings.Index(s[i+2:], closer)
+		if idx < 0 {
+			return 0, "", -1, false
+		}
+		return openerKinds[c], s[i+2 : i+2+idx], i + 2 + idx + len(closer), true
+	}
+	j := i + 1
+	for j < len(s) && isVarChar(s[j]) {
+		j++
+	}
+	if j == i+1 {
+		return 0, "", i + 1, false
+	}
+	return ExpandVar, s[i+1 : j], j, true
+}
+
+// Expand replaces the expansions in s with the results of fn, the
+// way uzbl-core does before running a command. An escaped \@ is
+// replaced with a literal @; all other characters, including quotes
+// and other escapes, are kept. Unterminated expansions are kept as
+// is. Start and End of the expansions passed to fn are offsets into
+// s.
+func Expand(s string, fn func(Expansion) string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			if s[i+1] != '@' {
+				b.WriteByte(c)
+			}
+			i++
+			b.WriteByte(s[i])
+		case c == '@':
+			kind, expr, end, ok := expansion(s, i)
+			if !ok {
+				b.WriteByte(c)
+				continue
+			}
+			b.WriteString(fn(Expansion{kind, i, end, expr}))
+			i = end - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
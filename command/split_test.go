@@ -0,0 +1,130 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	args, err := Split(`a 'b c' "d\"e" f\ g '' @<x y>@ 'u@{v}w' \@x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "b c", `d"e`, "f g", "", "@<x y>@", "u@{v}w", "@x"}
+	if got := Values(args); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if e := args[5].Expansions; len(e) != 1 || e[0].Kind != ExpandJS || e[0].Expr != "x y" {
+		t.Errorf("got expansions %+v for %q", e, args[5].Value)
+	}
+	if e := args[6].Expansions; len(e) != 1 || e[0].Kind != ExpandVar || e[0].Start != 1 || e[0].End != 5 {
+		t.Errorf("got expansions %+v for %q", e, args[6].Value)
+	}
+	if e := args[7].Expansions; len(e) != 0 {
+		t.Errorf("escaped @ was treated as expansion: %+v", e)
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	tests := []struct {
+		in     string
+		offset int
+		msg    string
+	}{
+		{`'unterminated`, 0, "unterminated ' quote"},
+		{`a "b c`, 2, `unterminated " quote`},
+		{`a \`, 2, "trailing backslash"},
+		{`'a\`, 2, "trailing backslash"},
+		{`@<document.title`, 0, "unterminated expansion @<"},
+		{`x @(ls`, 2, "unterminated expansion @("},
+		{`@[text`, 0, "unterminated expansion @["},
+		{`@{name`, 0, "unterminated expansion @{"},
+	}
+	for _, tt := range tests {
+		_, err := Split(tt.in)
+		serr, ok := err.(ErrSyntax)
+		if !ok {
+			t.Errorf("%q: got error %v, want ErrSyntax", tt.in, err)
+			continue
+		}
+		if serr.Offset != tt.offset || serr.Msg != tt.msg {
+			t.Errorf("%q: got %q at %d, want %q at %d", tt.in, serr.Msg, serr.Offset, tt.msg, tt.offset)
+		}
+	}
+}
+
+func FuzzQuoteRoundTrip(f *testing.F) {
+	for _, s := range []string{
+		"", "a b", "it's", `\`, "@", "a@ b", "@uri", "@<x>@", "@<'a'>@",
+		"x>@<y", `\@<x`, "@{a}'", `@(ls -l)@ "q"`, "@[<b>]@", "\t",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if strings.ContainsAny(s, "\r\n") {
+			return
+		}
+
+		q := Quote(s)
+		args, err := Split(q)
+		if err != nil || len(args) != 1 || args[0].Value != s {
+			t.Fatalf("Split(Quote(%q)) = Split(%q) = %+v, %v", s, q, args, err)
+		}
+		for _, e := range args[0].Expansions {
+			if e.Start < 0 || e.Start > e.End || e.End > len(s) {
+				t.Fatalf("invalid expansion %+v in %q", e, s)
+			}
+		}
+
+		l := Literal(s)
+		args, err = Split(l)
+		if err != nil || len(args) != 1 || args[0].Value != s || len(args[0].Expansions) != 0 {
+			t.Fatalf("Split(Literal(%q)) = Split(%q) = %+v, %v", s, l, args, err)
+		}
+
+		if s != "" {
+			e := Escape(s)
+			args, err = Split(e)
+			if err != nil || len(args) != 1 || args[0].Value != s || len(args[0].Expansions) != 0 {
+				t.Fatalf("Split(Escape(%q)) = Split(%q) = %+v, %v", s, e, args, err)
+			}
+		}
+
+		args, err = Split(Quote(s) + " " + Quote(s+"x"))
+		if err != nil || len(args) != 2 || args[0].Value != s || args[1].Value != s+"x" {
+			t.Fatalf("Split of two quoted arguments for %q = %+v, %v", s, args, err)
+		}
+	})
+}
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"uri": "http://example.com/", "title": "Example"}
+	fn := func(e Expansion) string {
+		switch e.Kind {
+		case ExpandVar:
+			return vars[e.Expr]
+		case ExpandJS:
+			return "js:" + e.Expr
+		case ExpandShell:
+			return "sh:" + e.Expr
+		}
+		return "escape:" + e.Expr
+	}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"@uri", "http://example.com/"},
+		{"'@{title}' @title.", "'Example' "},
+		{"a @<1 + 1>@ b", "a js:1 + 1 b"},
+		{"@(date)@@[<b>]@", "sh:dateescape:<b>"},
+		{`\@uri \' \\`, `@uri \' \\`},
+		{`\\@uri`, `\\http://example.com/`},
+		{"@<unterminated @", "@<unterminated @"},
+	}
+	for _, tt := range tests {
+		if got := Expand(tt.in, fn); got != tt.want {
+			t.Errorf("Expand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package uzbl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var errNoConfig = errors.New("no config file found")
+
+// configDirs returns the directories to search for uzbl/config, in
+// order of preference, as specified by the XDG base directory
+// specification.
+func configDirs() []string {
+	var dirs []string
+	home := os.Getenv("XDG_CONFIG_HOME")
+	if home == "" {
+		home = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	dirs = append(dirs, home)
+
+	sys := os.Getenv("XDG_CONFIG_DIRS")
+	if sys == "" {
+		sys = "/etc/xdg"
+	}
+	for _, dir := range filepath.SplitList(sys) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func (u *Uzbl) configPath() (string, error) {
+	if u.opts.Config != "" {
+		return u.opts.Config, nil
+	}
+	for _, dir := range configDirs() {
+		path := filepath.Join(dir, "uzbl", "config")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errNoConfig
+}
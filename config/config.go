@@ -0,0 +1,377 @@
+// Package config parses uzbl configuration files into a syntax tree
+// that can be inspected, modified and serialized back into commands.
+package config // import "honnef.co/go/uzbl/config"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"honnef.co/go/uzbl/command"
+)
+
+// Position describes where in a config file a node was found.
+type Position struct {
+	Filename string
+	Line     int
+}
+
+func (p Position) Pos() Position {
+	return p
+}
+
+func (p Position) String() string {
+	if p.Filename == "" {
+		return fmt.Sprintf("%d", p.Line)
+	}
+	return fmt.Sprintf("%s:%d", p.Filename, p.Line)
+}
+
+type Node interface {
+	Pos() Position
+	// String returns the node in uzbl config syntax.
+	String() string
+}
+
+// Blank is an empty line.
+type Blank struct {
+	Position
+}
+
+// Comment is a line starting with #. Text includes the #.
+type Comment struct {
+	Position
+	Text string
+}
+
+// Set assigns Value to the variable Name.
+type Set struct {
+	Position
+	Name  string
+	Value string
+}
+
+// OnEvent runs Command whenever Event is emitted.
+type OnEvent struct {
+	Position
+	Event   string
+	Command string
+}
+
+// Bind binds Keys to Command. Both are unquoted; as long as they
+// aren't modified, the bind is serialized exactly as it was parsed,
+// keeping escapes intact.
+type Bind struct {
+	Position
+	Keys    string
+	Command string
+
+	raw    string
+	parsed [2]string
+}
+
+// ModeBind binds Keys to Command in the given Modes. Like with Bind,
+// unmodified binds are serialized as they were parsed.
+type ModeBind struct {
+	Position
+	Modes   string
+	Keys    string
+	Command string
+
+	raw    string
+	parsed [3]string
+}
+
+// JS runs JavaScript. Context is the context to run in (e.g. page),
+// Kind is either string or file and Source is the script or path.
+type JS struct {
+	Position
+	Context string
+	Kind    string
+	Source  string
+}
+
+// Include includes another config file.
+type Include struct {
+	Position
+	Path string
+}
+
+// Command is any other command.
+type Command struct {
+	Position
+	Name string
+	Args string
+}
+
+func (n *Blank) String() string   { return "" }
+func (n *Comment) String() string { return n.Text }
+func (n *Set) String() string     { return join("set", n.Name, n.Value) }
+func (n *OnEvent) String() string { return join("@on_event", n.Event, n.Command) }
+func (n *Include) String() string { return join("include", n.Path) }
+func (n *Command) String() string { return join(n.Name, n.Args) }
+
+func (n *Bind) String() string {
+	if n.raw != "" && n.parsed == [2]string{n.Keys, n.Command} {
+		return join("@bind", n.raw)
+	}
+	return join("@bind", command.Quote(n.Keys), command.Quote(n.Command))
+}
+
+func (n *ModeBind) String() string {
+	if n.raw != "" && n.parsed == [3]string{n.Modes, n.Keys, n.Command} {
+		return join("@mode_bind", n.raw)
+	}
+	return join("@mode_bind", command.Quote(n.Modes), command.Quote(n.Keys), command.Quote(n.Command))
+}
+
+func (n *JS) String() string {
+	return join("js", n.Context, n.Kind, n.Source)
+}
+
+func join(parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// File is a parsed config file.
+type File struct {
+	Nodes []Node
+	// Errors are the problems found while parsing. Lines with errors
+	// are kept as Command nodes, so that they are passed to uzbl-core
+	// unchanged.
+	Errors []*Error
+}
+
+// Commands returns all nodes that aren't blank lines or comments,
+// serialized as commands suitable for Uzbl.Send.
+func (f *File) Commands() []string {
+	var out []string
+	for _, n := range f.Nodes {
+		switch n.(type) {
+		case *Blank, *Comment:
+			continue
+		}
+		out = append(out, n.String())
+	}
+	return out
+}
+
+// WriteTo writes the config, one node per line.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, n := range f.Nodes {
+		c, err := io.WriteString(w, n.String()+"\n")
+		total += int64(c)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+type Error struct {
+	Pos Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+type ErrIncludeCycle struct {
+	Path string
+}
+
+func (e ErrIncludeCycle) Error() string {
+	return fmt.Sprintf("Include cycle detected at '%s'", e.Path)
+}
+
+// Parse parses a config file. filename is only used for positions.
+// Malformed lines don't stop parsing; see File.Errors.
+func Parse(r io.Reader, filename string) (*File, error) {
+	f := &File{}
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		pos := Position{filename, line}
+		text := sc.Text()
+		for continues(text) && sc.Scan() {
+			line++
+			text = text[:len(text)-1] + sc.Text()
+		}
+		n, err := parseLine(pos, text)
+		if err != nil {
+			f.Errors = append(f.Errors, err.(*Error))
+			name, rest := cut(strings.TrimSpace(text))
+			n = &Command{pos, name, rest}
+		}
+		f.Nodes = append(f.Nodes, n)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// continues reports whether the line ends in an unescaped backslash.
+func continues(s string) bool {
+	n := 0
+	for i := len(s) - 1; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+func parseLine(pos Position, line string) (Node, error) {
+	text := strings.TrimSpace(line)
+	if text == "" {
+		return &Blank{pos}, nil
+	}
+	if text[0] == '#' {
+		return &Comment{pos, text}, nil
+	}
+
+	name, rest := cut(text)
+	switch name {
+	case "set":
+		varName, value := cut(rest)
+		if varName == "" {
+			return nil, &Error{pos, "set without variable name"}
+		}
+		if value == "=" {
+			value = ""
+		} else if strings.HasPrefix(value, "= ") {
+			value = strings.TrimLeft(value[2:], " \t")
+		}
+		return &Set{pos, varName, value}, nil
+	case "@on_event":
+		ev, cmd := cut(rest)
+		if ev == "" {
+			return nil, &Error{pos, "@on_event without event name"}
+		}
+		return &OnEvent{pos, ev, cmd}, nil
+	case "@bind":
+		args, err := splitBind(pos, name, rest, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &Bind{pos, args[0], args[1], rest, [2]string{args[0], args[1]}}, nil
+	case "@mode_bind":
+		args, err := splitBind(pos, name, rest, 3)
+		if err != nil {
+			return nil, err
+		}
+		return &ModeBind{pos, args[0], args[1], args[2], rest, [3]string{args[0], args[1], args[2]}}, nil
+	case "js":
+		ctx, tail := cut(rest)
+		kind, src := cut(tail)
+		if kind == "" {
+			return &Command{pos, name, rest}, nil
+		}
+		return &JS{pos, ctx, kind, src}, nil
+	case "include":
+		if rest == "" {
+			return nil, &Error{pos, "include without path"}
+		}
+		return &Include{pos, rest}, nil
+	}
+	return &Command{pos, name, rest}, nil
+}
+
+// splitBind splits the arguments of a bind into n values. Besides
+// n quoted arguments, it accepts the traditional form
+// "keys = command", where the command is the rest of the line.
+func splitBind(pos Position, name, rest string, n int) ([]string, error) {
+	if i := strings.Index(rest, " = "); i >= 0 {
+		head, err := command.Split(rest[:i])
+		if err == nil && len(head) == n-1 {
+			return append(command.Values(head), strings.TrimLeft(rest[i+3:], " \t")), nil
+		}
+	}
+	split, err := command.Split(rest)
+	if err != nil {
+		return nil, &Error{pos, err.Error()}
+	}
+	if len(split) != n {
+		return nil, &Error{pos, fmt.Sprintf("%s expects %d arguments, got %d", name, n, len(split))}
+	}
+	return command.Values(split), nil
+}
+
+// cut splits s at the first run of whitespace.
+func cut(s string) (string, string) {
+	idx := strings.IndexAny(s, " \t")
+	if idx < 0 {
+		return s, ""
+	}
+	return s[:idx], strings.TrimLeft(s[idx:], " \t")
+}
+
+// Load parses the config file at path and recursively replaces
+// include directives with the contents of the included files.
+// Relative includes are resolved relative to the directory of the
+// including file.
+func Load(path string) (*File, error) {
+	return load(path, nil)
+}
+
+func load(path string, stack []string) (*File, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range stack {
+		if p == abs {
+			return nil, ErrIncludeCycle{abs}
+		}
+	}
+	stack = append(stack, abs)
+
+	fd, err := os.Open(abs)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	f, err := Parse(fd, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []Node
+	for _, n := range f.Nodes {
+		inc, ok := n.(*Include)
+		if !ok {
+			nodes = append(nodes, n)
+			continue
+		}
+		p := expandHome(inc.Path)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(abs), p)
+		}
+		included, err := load(p, stack)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, included.Nodes...)
+		f.Errors = append(f.Errors, included.Errors...)
+	}
+	f.Nodes = nodes
+	return f, nil
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[1:])
+	}
+	return path
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseBinds(t *testing.T) {
+	tests := []struct {
+		line    string
+		keys    string
+		command string
+	}{
+		{`@bind o = uri %s`, "o", "uri %s"},
+		{`@bind o<uri:>_ = uri %s`, "o<uri:>_", "uri %s"},
+		{`@bind x 'uri http://\@foo'`, "x", "uri http://@foo"},
+		{`@bind 'g g' "scroll vertical begin"`, "g g", "scroll vertical begin"},
+	}
+	for _, tt := range tests {
+		f, err := Parse(strings.NewReader(tt.line), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f.Errors) != 0 {
+			t.Errorf("%s: unexpected errors %v", tt.line, f.Errors)
+			continue
+		}
+		b, ok := f.Nodes[0].(*Bind)
+		if !ok {
+			t.Errorf("%s: got %T, want *Bind", tt.line, f.Nodes[0])
+			continue
+		}
+		if b.Keys != tt.keys || b.Command != tt.command {
+			t.Errorf("%s: got %q, %q", tt.line, b.Keys, b.Command)
+		}
+		if b.String() != tt.line {
+			t.Errorf("%s: serialized as %s", tt.line, b.String())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	src := "set\n@bind 'unterminated\nset a = b\n@mode_bind x y\n"
+	f, err := Parse(strings.NewReader(src), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Nodes) != 4 {
+		t.Fatalf("got %d nodes, want 4", len(f.Nodes))
+	}
+	var lines []int
+	for _, err := range f.Errors {
+		lines = append(lines, err.Pos.Line)
+	}
+	if len(lines) != 3 || lines[0] != 1 || lines[1] != 2 || lines[2] != 4 {
+		t.Errorf("got errors in lines %v, want [1 2 4]", lines)
+	}
+	if got := f.Nodes[1].String(); got != "@bind 'unterminated" {
+		t.Errorf("malformed line serialized as %q", got)
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadIncludes(t *testing.T) {
+	dir := t.TempDir()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	writeFiles(t, dir, map[string]string{
+		"config":          "set a = 1\ninclude sub/binds\ninclude ~/home.conf\ninclude " + filepath.Join(dir, "abs.conf") + "\nset e = 5\n",
+		"sub/binds":       "set b = 2\ninclude nested.conf\n",
+		"sub/nested.conf": "set c = 3\nset\n",
+		"abs.conf":        "set d = 4\n",
+	})
+	writeFiles(t, home, map[string]string{"home.conf": "set h = 6\n"})
+
+	f, err := Load(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, n := range f.Nodes {
+		if s, ok := n.(*Set); ok {
+			names = append(names, s.Name)
+		}
+	}
+	if got := strings.Join(names, " "); got != "a b c h d e" {
+		t.Errorf("got variables %q, want %q", got, "a b c h d e")
+	}
+	if len(f.Errors) != 1 || f.Errors[0].Pos.Line != 2 || !strings.HasSuffix(f.Errors[0].Pos.Filename, "nested.conf") {
+		t.Errorf("got errors %v, want one in line 2 of nested.conf", f.Errors)
+	}
+}
+
+func TestLoadIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config": "include a\n",
+		"a":      "include b\n",
+		"b":      "include a\n",
+	})
+	_, err := Load(filepath.Join(dir, "config"))
+	want := ErrIncludeCycle{filepath.Join(dir, "a")}
+	if err != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
+
+func TestLoadMissingInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"config": "include missing\n"})
+	if _, err := Load(filepath.Join(dir, "config")); !os.IsNotExist(err) {
+		t.Errorf("got %v, want a not-exist error", err)
+	}
+}
@@ -0,0 +1,53 @@
+package uzbl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigPath(t *testing.T) {
+	home := t.TempDir()
+	user := t.TempDir()
+	sys1 := t.TempDir()
+	sys2 := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", user)
+	t.Setenv("XDG_CONFIG_DIRS", sys1+string(filepath.ListSeparator)+sys2)
+
+	create := func(dir string) string {
+		path := filepath.Join(dir, "uzbl", "config")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	u := New(Options{})
+	check := func(want string, wantErr error) {
+		t.Helper()
+		got, err := u.configPath()
+		if got != want || err != wantErr {
+			t.Errorf("got (%q, %v), want (%q, %v)", got, err, want, wantErr)
+		}
+	}
+
+	check("", errNoConfig)
+	want := create(sys2)
+	check(want, nil)
+	want = create(sys1)
+	check(want, nil)
+	want = create(user)
+	check(want, nil)
+
+	// without XDG_CONFIG_HOME, ~/.config is used
+	t.Setenv("XDG_CONFIG_HOME", "")
+	check(filepath.Join(sys1, "uzbl", "config"), nil)
+	want = create(filepath.Join(home, ".config"))
+	check(want, nil)
+
+	u = New(Options{Config: "/explicit/config"})
+	check("/explicit/config", nil)
+}
@@ -1 +1,24 @@
 package uzbl
+
+import (
+	"honnef.co/go/uzbl/command"
+)
+
+// Send sends cmd to uzbl-core like Uzbl.Send, attributing it to the
+// plugin that registered the handler for errors reported by
+// uzbl-core.
+func (ev *Event) Send(cmd string) error {
+	return ev.Uzbl.send(ev.source, cmd)
+}
+
+// SetKeymap activates k like InputManager.SetKeymap. The keymap is
+// deactivated again if the plugin that registered the handler gets
+// disabled.
+func (ev *Event) SetKeymap(k *Keymap) {
+	ev.Uzbl.IM.setKeymap(k, ev.source)
+}
+
+// Exec is like Uzbl.Exec but attributes the commands like Send.
+func (ev *Event) Exec(cmds ...command.Command) error {
+	return ev.Uzbl.exec(ev.source, cmds)
+}
@@ -2,16 +2,17 @@ package event_manager // import "honnef.co/go/uzbl/event_manager"
 
 import (
 	"bufio"
+	"context"
 	"io"
-	"log"
 	"strconv"
 	"strings"
+	"sync"
+
+	"honnef.co/go/uzbl/command"
 )
 
 type Handler func(*Event) error
 
-type handlerMap map[string][]Handler
-
 type Event struct {
 	Name   string
 	Detail string
@@ -19,67 +20,20 @@ type Event struct {
 	PID    int
 }
 
-func (ev *Event) ParseDetail(n int) []string {
-	var out []string
-
-	start := 0
-	inString := false
-	stringDelim := rune(0)
-	escape := false
-
-	progress := func(start, i int) {
-		arg := ev.Detail[start:i]
-		arg = strings.Replace(arg, `\`, "", -1)
-		out = append(out, arg)
-		inString = false
-	}
-
-	for i, c := range ev.Detail {
-		switch c {
-		case ' ':
-			if escape {
-				escape = false
-				continue
-			}
-
-			if inString {
-				continue
-			}
-
-			if ev.Detail[start:i] == "" {
-				// previous one was space or start of string
-				start = i + 1
-				continue
-			}
-
-			progress(start, i)
-			start = i + 1
-		case '"', '\'':
-			if escape {
-				escape = false
-				continue
-			}
-
-			if !inString {
-				start = i + 1
-				inString = true
-				stringDelim = c
-				continue
-			}
+// Args splits the detail into arguments, removing quotes and
+// escapes. See command.SplitLiteral.
+func (ev *Event) Args() ([]string, error) {
+	return command.SplitLiteral(ev.Detail)
+}
 
-			if stringDelim == c {
-				progress(start, i)
-				start = i + 1
-			}
-			escape = false
-		case '\\':
-			escape = !escape
-		default:
-			escape = false
-		}
-	}
-	if start < len(ev.Detail) {
-		progress(start, len(ev.Detail))
+// ParseDetail splits the detail into n arguments, padding with empty
+// strings if there are fewer. If n is negative, all arguments are
+// returned. Malformed details yield the arguments that could be
+// parsed; use Args to detect errors.
+func (ev *Event) ParseDetail(n int) []string {
+	out, _ := ev.Args()
+	if n < 0 {
+		return out
 	}
 	if n > len(out) {
 		return pad(out, n)
@@ -97,42 +51,176 @@ func pad(s []string, n int) []string {
 }
 
 type Manager struct {
-	stdout   io.Reader
-	handlers handlerMap
+	stdout     io.Reader
+	mu         sync.RWMutex
+	handlers   *handlerSet
+	immediate  *handlerSet
+	middleware []Middleware
+	traceMu    sync.Mutex
+	trace      io.Writer
 }
 
 func New(stdout io.Reader) *Manager {
 	em := &Manager{
-		stdout:   stdout,
-		handlers: make(handlerMap),
+		stdout:    stdout,
+		handlers:  newHandlerSet(),
+		immediate: newHandlerSet(),
 	}
 	return em
 }
 
-func (em *Manager) AddHandler(ev string, fn Handler) {
-	em.handlers[ev] = append(em.handlers[ev], fn)
+// AddHandler registers fn to be called for every event named ev. If
+// ev ends in *, it is a pattern matching all events starting with
+// the preceding prefix, e.g. LOAD_* or * for all events.
+//
+// For any event, handlers for the exact name run first, followed by
+// pattern handlers, longer prefixes first. Handlers of the same name
+// or pattern run in order of registration. A handler can return
+// ErrStopPropagation to prevent the remaining handlers from running.
+//
+// It is safe to call AddHandler concurrently with Listen, including
+// from within handlers.
+func (em *Manager) AddHandler(ev string, fn Handler) *Registration {
+	return em.add(em.handlers, ev, &handler{fn: fn})
+}
+
+// AddHandlerPriority is like AddHandler, but with a priority other
+// than the default of 0. Handlers with higher priorities run before
+// those with lower ones, regardless of how they match the event.
+func (em *Manager) AddHandlerPriority(ev string, priority int, fn Handler) *Registration {
+	return em.add(em.handlers, ev, &handler{fn: fn, priority: priority})
+}
+
+// AddPredicateHandler is like AddHandler, but fn is only called for
+// events for which pred returns true.
+func (em *Manager) AddPredicateHandler(ev string, pred func(*Event) bool, fn Handler) *Registration {
+	return em.add(em.handlers, ev, &handler{fn: fn, pred: pred})
+}
+
+// Registrations returns the regular handlers registered for exactly
+// the name ev, not including pattern handlers.
+func (em *Manager) Registrations(ev string) []*Registration {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	hs := em.handlers.exact[ev]
+	out := make([]*Registration, len(hs))
+	for i, h := range hs {
+		out[i] = h.reg
+	}
+	return out
+}
+
+// Once is like AddHandler, but fn is only called for the first
+// matching event, after which the handler is removed.
+func (em *Manager) Once(ev string, fn Handler) *Registration {
+	return em.add(em.handlers, ev, &handler{fn: fn, once: true})
+}
+
+// WaitFor waits for the next event named ev for which pred returns
+// true, or any event named ev if pred is nil. ev may be a pattern.
+//
+// WaitFor uses an immediate handler, so it may be called from
+// within a regular handler. The returned event may not have been
+// seen by the regular handlers yet.
+func (em *Manager) WaitFor(ctx context.Context, ev string, pred func(*Event) bool) (*Event, error) {
+	ch := make(chan *Event, 1)
+	reg := em.add(em.immediate, ev, &handler{
+		fn: func(event *Event) error {
+			ch <- event
+			return nil
+		},
+		pred: pred,
+		once: true,
+	})
+	select {
+	case event := <-ch:
+		return event, nil
+	case <-ctx.Done():
+		reg.Remove()
+		return nil, ctx.Err()
+	}
+}
+
+// Use adds middleware that wraps every handler call, both for
+// regular and immediate handlers. Middleware added first is the
+// outermost.
+func (em *Manager) Use(mw ...Middleware) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	middleware := make([]Middleware, 0, len(em.middleware)+len(mw))
+	middleware = append(middleware, em.middleware...)
+	em.middleware = append(middleware, mw...)
+}
+
+// AddImmediateHandler adds a handler that runs on the reading
+// goroutine as soon as an event has been read, before the event is
+// queued for the regular handlers. This allows regular handlers to
+// block while waiting for other events. Immediate handlers must not
+// block.
+func (em *Manager) AddImmediateHandler(ev string, fn Handler) *Registration {
+	return em.add(em.immediate, ev, &handler{fn: fn})
 }
 
+// Listen reads events until reading fails and dispatches them to
+// the handlers. Regular handlers run sequentially on a separate
+// goroutine; Listen returns once all read events have been handled.
 func (em *Manager) Listen() error {
-	r := bufio.NewReader(em.stdout)
+	return em.Serve(em.stdout)
+}
+
+// Serve is like Listen but reads events from r. This allows reusing
+// the handlers for a new connection.
+func (em *Manager) Serve(r io.Reader) error {
+	return em.serve(r, true)
+}
+
+// serve implements Serve. Lines are only recorded if record is set,
+// so that replaying a trace doesn't record it again.
+func (em *Manager) serve(r io.Reader, record bool) error {
+	q := newQueue()
+	done := make(chan struct{})
+	go func() {
+		for {
+			ev, ok := q.pop()
+			if !ok {
+				break
+			}
+			em.dispatch(em.handlers, ev)
+		}
+		close(done)
+	}()
+
+	br := bufio.NewReader(r)
+	var err error
 	for {
-		line, err := r.ReadString('\n')
+		var line string
+		line, err = br.ReadString('\n')
 		if err != nil {
-			return err
+			break
 		}
 		line = line[:len(line)-1]
-		// log.Println(line)
+		if record {
+			em.record(line)
+		}
 
-		em.process(line)
+		ev := parseEvent(line)
+		if ev == nil {
+			continue
+		}
+		em.dispatch(em.immediate, ev)
+		q.push(ev)
 	}
+	q.close()
+	<-done
+	return err
 }
 
-func (em *Manager) process(line string) {
+func parseEvent(line string) *Event {
 	var cookie string
 	if strings.HasPrefix(line, "REQUEST-") {
 		idx := strings.Index(line, " ")
 		if idx < 0 {
-			return
+			return nil
 		}
 		parts := strings.SplitN(line[:idx], "-", 2)
 		cookie = parts[1]
@@ -142,41 +230,78 @@ func (em *Manager) process(line string) {
 	end := strings.Index(line, "]")
 	if start < 0 || end < 0 {
 		// not a valid event
-		return
+		return nil
 	}
 
 	pid, err := strconv.Atoi(line[start+1 : end])
 	if err != nil {
 		// not a valid event
-		return
+		return nil
 	}
 
 	idx := strings.Index(line, "]")
 	if idx < 0 {
 		// not a valid event
-		return
+		return nil
 	}
 	if idx+2 > len(line)-1 {
 		// not a valid event
-		return
+		return nil
 	}
 	line = line[idx+2:]
 	idx = strings.Index(line, " ")
 	if idx < 0 {
 		// not a valid event
-		return
+		return nil
 	}
 	ev := line[:idx]
 	detail := line[idx+1:]
-	event := &Event{ev, detail, cookie, pid}
+	return &Event{ev, detail, cookie, pid}
+}
+
+// queue is an unbounded FIFO of events. It is unbounded so that
+// reading never stalls behind a handler that is waiting for a
+// later event.
+type queue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []*Event
+	closed bool
+}
+
+func newQueue() *queue {
+	q := &queue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *queue) push(ev *Event) {
+	q.mu.Lock()
+	q.events = append(q.events, ev)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
 
-	if cookie != "" {
-		ev = "REQUEST-" + ev
+func (q *queue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop blocks until an event is available. It returns false once the
+// queue has been closed and drained.
+func (q *queue) pop() (*Event, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.events) == 0 && !q.closed {
+		q.cond.Wait()
 	}
-	for _, fn := range em.handlers[ev] {
-		err := fn(event)
-		if err != nil {
-			log.Println(err)
-		}
+	if len(q.events) == 0 {
+		return nil, false
 	}
+	ev := q.events[0]
+	q.events[0] = nil
+	q.events = q.events[1:]
+	return ev, true
 }
@@ -0,0 +1,125 @@
+package event_manager
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnce(t *testing.T) {
+	var calls []string
+	em := New(nil)
+	em.Once("FOO", func(ev *Event) error {
+		calls = append(calls, ev.Detail)
+		return nil
+	})
+	serve(em, "EVENT [1] FOO 1", "EVENT [1] FOO 2", "EVENT [1] FOO 3")
+	if got := strings.Join(calls, " "); got != "1" {
+		t.Errorf("got %q, want %q", got, "1")
+	}
+	if n := len(em.handlers.exact["FOO"]); n != 0 {
+		t.Errorf("%d handlers left after Once fired", n)
+	}
+}
+
+func TestWaitForPredicate(t *testing.T) {
+	pr, pw := io.Pipe()
+	em := New(pr)
+	done := make(chan struct{})
+	go func() {
+		em.Listen()
+		close(done)
+	}()
+
+	type result struct {
+		ev  *Event
+		err error
+	}
+	res := make(chan result, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		ev, err := em.WaitFor(ctx, "LOAD_*", func(ev *Event) bool { return ev.Detail == "'b'" })
+		res <- result{ev, err}
+	}()
+	// wait for the handler to be registered
+	for {
+		em.mu.RLock()
+		n := len(em.immediate.patterns["LOAD_"])
+		em.mu.RUnlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	io.WriteString(pw, "EVENT [1] LOAD_START 'a'\nEVENT [1] KEY_PRESS 'b'\nEVENT [1] LOAD_FINISH 'b'\n")
+
+	r := <-res
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.ev.Name != "LOAD_FINISH" {
+		t.Errorf("got %s %s, want LOAD_FINISH 'b'", r.ev.Name, r.ev.Detail)
+	}
+	pw.Close()
+	<-done
+}
+
+func TestWaitForInHandler(t *testing.T) {
+	pr, pw := io.Pipe()
+	em := New(pr)
+	got := make(chan string, 1)
+	em.AddHandler("ASK", func(ev *Event) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		// the reply is only sent once the handler is running, so
+		// it can't be delivered through the regular handlers
+		go io.WriteString(pw, "EVENT [1] REPLY 42\n")
+		reply, err := em.WaitFor(ctx, "REPLY", nil)
+		if err != nil {
+			got <- err.Error()
+			return nil
+		}
+		got <- reply.Detail
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		em.Listen()
+		close(done)
+	}()
+	io.WriteString(pw, "EVENT [1] ASK \n")
+	if s := <-got; s != "42" {
+		t.Errorf("got %q, want %q", s, "42")
+	}
+	pw.Close()
+	<-done
+}
+
+func TestWaitForCancel(t *testing.T) {
+	em := New(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			em.mu.RLock()
+			n := len(em.immediate.exact["FOO"])
+			em.mu.RUnlock()
+			if n > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if _, err := em.WaitFor(ctx, "FOO", nil); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	em.mu.RLock()
+	n := len(em.immediate.exact["FOO"])
+	em.mu.RUnlock()
+	if n != 0 {
+		t.Errorf("%d handlers left after cancelling WaitFor", n)
+	}
+}
@@ -0,0 +1,247 @@
+// Package events provides typed representations of the events
+// emitted by uzbl-core.
+package events // import "honnef.co/go/uzbl/event_manager/events"
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/event_manager"
+)
+
+type ErrMalformed struct {
+	Name   string
+	Detail string
+}
+
+func (e ErrMalformed) Error() string {
+	return fmt.Sprintf("Malformed %s event: '%s'", e.Name, e.Detail)
+}
+
+type ErrUnknownEvent struct {
+	Name string
+}
+
+func (e ErrUnknownEvent) Error() string {
+	return fmt.Sprintf("Unknown event '%s'", e.Name)
+}
+
+// Load is the detail of LOAD_START, LOAD_COMMIT and LOAD_FINISH.
+type Load struct {
+	URI string
+}
+
+type LoadProgress struct {
+	Percent int
+}
+
+type LoadError struct {
+	URI     string
+	Code    int
+	Message string
+}
+
+// Key is the detail of KEY_PRESS and KEY_RELEASE.
+type Key struct {
+	Mods []string
+	Key  string
+}
+
+// Scroll is the detail of SCROLL_VERT and SCROLL_HORIZ.
+type Scroll struct {
+	Value float64
+	Min   float64
+	Max   float64
+	Page  float64
+}
+
+type Geometry struct {
+	Width  int
+	Height int
+	X      int
+	Y      int
+}
+
+// VariableSet is the detail of VARIABLE_SET. Value is unquoted and
+// unescaped but otherwise not interpreted according to Type.
+type VariableSet struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+type NavigationStarting struct {
+	URI   string
+	Frame string
+	Args  []string
+}
+
+type TitleChanged struct {
+	Title string
+}
+
+// Request is a request event, sent by uzbl-core as
+// REQUEST-<cookie> [pid] <name> <args>. Replies have to be sent using
+// the cookie.
+type Request struct {
+	Name   string
+	Cookie string
+	Args   []string
+}
+
+func malformed(ev *event_manager.Event) error {
+	return ErrMalformed{ev.Name, ev.Detail}
+}
+
+// single returns the only argument of ev's detail, with quotes and
+// escapes removed. An empty detail yields the empty string.
+func single(ev *event_manager.Event) (string, error) {
+	args, err := ev.Args()
+	if err != nil || len(args) > 1 {
+		return "", malformed(ev)
+	}
+	if len(args) == 0 {
+		return "", nil
+	}
+	return args[0], nil
+}
+
+func DecodeLoad(ev *event_manager.Event) (Load, error) {
+	uri, err := single(ev)
+	if err != nil {
+		return Load{}, err
+	}
+	return Load{URI: uri}, nil
+}
+
+// DecodeLoadProgress decodes LOAD_PROGRESS. An empty detail is
+// treated as 100%.
+func DecodeLoadProgress(ev *event_manager.Event) (LoadProgress, error) {
+	if ev.Detail == "" {
+		return LoadProgress{Percent: 100}, nil
+	}
+	n, err := strconv.Atoi(ev.ParseDetail(1)[0])
+	if err != nil {
+		return LoadProgress{}, malformed(ev)
+	}
+	return LoadProgress{Percent: n}, nil
+}
+
+func DecodeLoadError(ev *event_manager.Event) (LoadError, error) {
+	args := ev.ParseDetail(3)
+	code, err := strconv.Atoi(args[1])
+	if err != nil {
+		return LoadError{}, malformed(ev)
+	}
+	return LoadError{URI: args[0], Code: code, Message: args[2]}, nil
+}
+
+func DecodeKey(ev *event_manager.Event) (Key, error) {
+	args := ev.ParseDetail(2)
+	if args[1] == "" {
+		return Key{}, malformed(ev)
+	}
+	var mods []string
+	if args[0] != "" {
+		mods = strings.Split(args[0], "|")
+	}
+	return Key{Mods: mods, Key: args[1]}, nil
+}
+
+func DecodeScroll(ev *event_manager.Event) (Scroll, error) {
+	args := ev.ParseDetail(4)
+	var f [4]float64
+	for i, arg := range args {
+		var err error
+		f[i], err = strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return Scroll{}, malformed(ev)
+		}
+	}
+	return Scroll{Value: f[0], Min: f[1], Max: f[2], Page: f[3]}, nil
+}
+
+// DecodeGeometry decodes GEOMETRY_CHANGED, whose detail has the
+// form 'WxH+X+Y'.
+func DecodeGeometry(ev *event_manager.Event) (Geometry, error) {
+	s, err := single(ev)
+	if err != nil {
+		return Geometry{}, err
+	}
+	var g Geometry
+	_, err = fmt.Sscanf(s, "%dx%d+%d+%d", &g.Width, &g.Height, &g.X, &g.Y)
+	if err != nil {
+		return Geometry{}, malformed(ev)
+	}
+	return g, nil
+}
+
+func DecodeVariableSet(ev *event_manager.Event) (VariableSet, error) {
+	parts := strings.SplitN(ev.Detail, " ", 3)
+	if len(parts) < 3 {
+		return VariableSet{}, malformed(ev)
+	}
+	value, err := command.SplitLiteral(parts[2])
+	if err != nil || len(value) != 1 {
+		return VariableSet{}, malformed(ev)
+	}
+	return VariableSet{Name: parts[0], Type: parts[1], Value: value[0]}, nil
+}
+
+func DecodeNavigationStarting(ev *event_manager.Event) (NavigationStarting, error) {
+	args := ev.ParseDetail(-1)
+	if len(args) < 2 {
+		return NavigationStarting{}, malformed(ev)
+	}
+	return NavigationStarting{URI: args[0], Frame: args[1], Args: args[2:]}, nil
+}
+
+func DecodeTitleChanged(ev *event_manager.Event) (TitleChanged, error) {
+	title, err := single(ev)
+	if err != nil {
+		return TitleChanged{}, err
+	}
+	return TitleChanged{Title: title}, nil
+}
+
+func DecodeRequest(ev *event_manager.Event) (Request, error) {
+	if ev.Cookie == "" {
+		return Request{}, malformed(ev)
+	}
+	return Request{
+		Name:   ev.Name,
+		Cookie: ev.Cookie,
+		Args:   ev.ParseDetail(-1),
+	}, nil
+}
+
+// Decode decodes any of the events known to this package, returning
+// one of its types.
+func Decode(ev *event_manager.Event) (interface{}, error) {
+	if ev.Cookie != "" {
+		return DecodeRequest(ev)
+	}
+	switch ev.Name {
+	case "LOAD_START", "LOAD_COMMIT", "LOAD_FINISH":
+		return DecodeLoad(ev)
+	case "LOAD_PROGRESS":
+		return DecodeLoadProgress(ev)
+	case "LOAD_ERROR":
+		return DecodeLoadError(ev)
+	case "KEY_PRESS", "KEY_RELEASE":
+		return DecodeKey(ev)
+	case "SCROLL_VERT", "SCROLL_HORIZ":
+		return DecodeScroll(ev)
+	case "GEOMETRY_CHANGED":
+		return DecodeGeometry(ev)
+	case "VARIABLE_SET":
+		return DecodeVariableSet(ev)
+	case "NAVIGATION_STARTING":
+		return DecodeNavigationStarting(ev)
+	case "TITLE_CHANGED":
+		return DecodeTitleChanged(ev)
+	}
+	return nil, ErrUnknownEvent{ev.Name}
+}
@@ -0,0 +1,70 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"honnef.co/go/uzbl/event_manager"
+)
+
+func TestOnRequest(t *testing.T) {
+	em := event_manager.New(strings.NewReader("REQUEST-42 [123] ADBLOCK http://example.com/ a main b\n"))
+	var got []Request
+	OnRequest(em, "ADBLOCK", func(r Request) error {
+		got = append(got, r)
+		return nil
+	})
+	em.Listen()
+
+	if len(got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(got))
+	}
+	r := got[0]
+	if r.Name != "ADBLOCK" || r.Cookie != "42" || len(r.Args) != 4 || r.Args[2] != "main" {
+		t.Errorf("got %#v", r)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := []event_manager.Event{
+		{Name: "TITLE_CHANGED", Detail: "'unterminated"},
+		{Name: "LOAD_COMMIT", Detail: "two args"},
+		{Name: "VARIABLE_SET", Detail: "title str"},
+		{Name: "VARIABLE_SET", Detail: "title str 'a' 'b'"},
+	}
+	for _, ev := range tests {
+		if v, err := Decode(&ev); err == nil {
+			t.Errorf("%s %s: got %+v, want an error", ev.Name, ev.Detail, v)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		ev   event_manager.Event
+		want string
+	}{
+		{event_manager.Event{Name: "LOAD_COMMIT", Detail: "'http://example.com/'"}, "{URI:http://example.com/}"},
+		{event_manager.Event{Name: "LOAD_PROGRESS", Detail: "45"}, "{Percent:45}"},
+		{event_manager.Event{Name: "KEY_PRESS", Detail: "'Shift|Ctrl' a"}, "{Mods:[Shift Ctrl] Key:a}"},
+		{event_manager.Event{Name: "SCROLL_VERT", Detail: "10 0 100 20"}, "{Value:10 Min:0 Max:100 Page:20}"},
+		{event_manager.Event{Name: "GEOMETRY_CHANGED", Detail: "'800x600+10+20'"}, "{Width:800 Height:600 X:10 Y:20}"},
+		{event_manager.Event{Name: "ADBLOCK", Detail: "a b", Cookie: "1"}, "{Name:ADBLOCK Cookie:1 Args:[a b]}"},
+		{event_manager.Event{Name: "TITLE_CHANGED", Detail: `'it\'s a title'`}, "{Title:it's a title}"},
+		{event_manager.Event{Name: "LOAD_START", Detail: `'http://example.com/a\\b'`}, `{URI:http://example.com/a\b}`},
+		{event_manager.Event{Name: "VARIABLE_SET", Detail: `status_message str 'it\'s <b>done</b>'`}, "{Name:status_message Type:str Value:it's <b>done</b>}"},
+		{event_manager.Event{Name: "VARIABLE_SET", Detail: "zoom_level float 1.5"}, "{Name:zoom_level Type:float Value:1.5}"},
+		{event_manager.Event{Name: "VARIABLE_SET", Detail: "title str ''"}, "{Name:title Type:str Value:}"},
+	}
+	for _, tt := range tests {
+		v, err := Decode(&tt.ev)
+		if err != nil {
+			t.Errorf("%s: %s", tt.ev.Name, err)
+			continue
+		}
+		if got := fmt.Sprintf("%+v", v); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.ev.Name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"honnef.co/go/uzbl/event_manager"
+)
+
+// Source is anything handlers can be registered with, such as an
+// event_manager.Manager or the value returned by uzbl.Uzbl.Events.
+type Source interface {
+	AddHandler(ev string, fn event_manager.Handler) *event_manager.Registration
+}
+
+func OnLoadStart(src Source, fn func(Load) error) *event_manager.Registration {
+	return onLoad(src, "LOAD_START", fn)
+}
+
+func OnLoadCommit(src Source, fn func(Load) error) *event_manager.Registration {
+	return onLoad(src, "LOAD_COMMIT", fn)
+}
+
+func OnLoadFinish(src Source, fn func(Load) error) *event_manager.Registration {
+	return onLoad(src, "LOAD_FINISH", fn)
+}
+
+func onLoad(src Source, name string, fn func(Load) error) *event_manager.Registration {
+	return src.AddHandler(name, func(ev *event_manager.Event) error {
+		l, err := DecodeLoad(ev)
+		if err != nil {
+			return err
+		}
+		return fn(l)
+	})
+}
+
+func OnLoadProgress(src Source, fn func(LoadProgress) error) *event_manager.Registration {
+	return src.AddHandler("LOAD_PROGRESS", func(ev *event_manager.Event) error {
+		p, err := DecodeLoadProgress(ev)
+		if err != nil {
+			return err
+		}
+		return fn(p)
+	})
+}
+
+func OnLoadError(src Source, fn func(LoadError) error) *event_manager.Registration {
+	return src.AddHandler("LOAD_ERROR", func(ev *event_manager.Event) error {
+		e, err := DecodeLoadError(ev)
+		if err != nil {
+			return err
+		}
+		return fn(e)
+	})
+}
+
+func OnKeyPress(src Source, fn func(Key) error) *event_manager.Registration {
+	return onKey(src, "KEY_PRESS", fn)
+}
+
+func OnKeyRelease(src Source, fn func(Key) error) *event_manager.Registration {
+	return onKey(src, "KEY_RELEASE", fn)
+}
+
+func onKey(src Source, name string, fn func(Key) error) *event_manager.Registration {
+	return src.AddHandler(name, func(ev *event_manager.Event) error {
+		k, err := DecodeKey(ev)
+		if err != nil {
+			return err
+		}
+		return fn(k)
+	})
+}
+
+func OnScrollVert(src Source, fn func(Scroll) error) *event_manager.Registration {
+	return onScroll(src, "SCROLL_VERT", fn)
+}
+
+func OnScrollHoriz(src Source, fn func(Scroll) error) *event_manager.Registration {
+	return onScroll(src, "SCROLL_HORIZ", fn)
+}
+
+func onScroll(src Source, name string, fn func(Scroll) error) *event_manager.Registration {
+	return src.AddHandler(name, func(ev *event_manager.Event) error {
+		s, err := DecodeScroll(ev)
+		if err != nil {
+			return err
+		}
+		return fn(s)
+	})
+}
+
+func OnGeometryChanged(src Source, fn func(Geometry) error) *event_manager.Registration {
+	return src.AddHandler("GEOMETRY_CHANGED", func(ev *event_manager.Event) error {
+		g, err := DecodeGeometry(ev)
+		if err != nil {
+			return err
+		}
+		return fn(g)
+	})
+}
+
+func OnVariableSet(src Source, fn func(VariableSet) error) *event_manager.Registration {
+	return src.AddHandler("VARIABLE_SET", func(ev *event_manager.Event) error {
+		v, err := DecodeVariableSet(ev)
+		if err != nil {
+			return err
+		}
+		return fn(v)
+	})
+}
+
+func OnNavigationStarting(src Source, fn func(NavigationStarting) error) *event_manager.Registration {
+	return src.AddHandler("NAVIGATION_STARTING", func(ev *event_manager.Event) error {
+		n, err := DecodeNavigationStarting(ev)
+		if err != nil {
+			return err
+		}
+		return fn(n)
+	})
+}
+
+func OnTitleChanged(src Source, fn func(TitleChanged) error) *event_manager.Registration {
+	return src.AddHandler("TITLE_CHANGED", func(ev *event_manager.Event) error {
+		t, err := DecodeTitleChanged(ev)
+		if err != nil {
+			return err
+		}
+		return fn(t)
+	})
+}
+
+// OnRequest registers fn for request events named name.
+func OnRequest(src Source, name string, fn func(Request) error) *event_manager.Registration {
+	return src.AddHandler("REQUEST-"+name, func(ev *event_manager.Event) error {
+		r, err := DecodeRequest(ev)
+		if err != nil {
+			return err
+		}
+		return fn(r)
+	})
+}
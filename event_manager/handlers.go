@@ -0,0 +1,176 @@
+package event_manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrStopPropagation can be returned by handlers to prevent the
+// remaining handlers from seeing the event.
+var ErrStopPropagation = errors.New("stop propagation")
+
+// Middleware wraps handlers, for example to trace or recover from
+// panics.
+type Middleware func(Handler) Handler
+
+// Recover is a middleware that turns panics in handlers into errors.
+func Recover(fn Handler) Handler {
+	return func(ev *Event) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic in handler for %s: %v", ev.Name, r)
+			}
+		}()
+		return fn(ev)
+	}
+}
+
+type handler struct {
+	fn       Handler
+	pred     func(*Event) bool
+	priority int
+	// once handlers are removed before they are called for the
+	// first time.
+	once    bool
+	reg     *Registration
+	removed int32
+}
+
+// handlerMap maps event names to handlers. The slices are never
+// modified in place, so that they can be iterated without holding
+// the lock.
+type handlerMap map[string][]*handler
+
+// handlerSet holds handlers for exact event names and for patterns.
+// Patterns are stored by their prefix, "" being the wildcard.
+type handlerSet struct {
+	exact    handlerMap
+	patterns handlerMap
+}
+
+func newHandlerSet() *handlerSet {
+	return &handlerSet{
+		exact:    make(handlerMap),
+		patterns: make(handlerMap),
+	}
+}
+
+// DetailMatches returns a predicate for AddPredicateHandler that
+// matches events whose detail matches re.
+func DetailMatches(re *regexp.Regexp) func(*Event) bool {
+	return func(ev *Event) bool {
+		return re.MatchString(ev.Detail)
+	}
+}
+
+// Registration is a registered handler.
+type Registration struct {
+	em *Manager
+	m  handlerMap
+	ev string
+	h  *handler
+}
+
+// Remove unregisters the handler. Once Remove returns, the handler
+// will not be called anymore, although a call that is already in
+// progress may still be running. Remove may be called multiple
+// times and from within the handler itself.
+func (r *Registration) Remove() {
+	atomic.StoreInt32(&r.h.removed, 1)
+
+	r.em.mu.Lock()
+	defer r.em.mu.Unlock()
+	hs := r.m[r.ev]
+	for i, h := range hs {
+		if h != r.h {
+			continue
+		}
+		if len(hs) == 1 {
+			delete(r.m, r.ev)
+			return
+		}
+		out := make([]*handler, 0, len(hs)-1)
+		out = append(out, hs[:i]...)
+		out = append(out, hs[i+1:]...)
+		r.m[r.ev] = out
+		return
+	}
+}
+
+func (em *Manager) add(set *handlerSet, ev string, h *handler) *Registration {
+	m := set.exact
+	if strings.HasSuffix(ev, "*") {
+		m = set.patterns
+		ev = ev[:len(ev)-1]
+	}
+	reg := &Registration{em, m, ev, h}
+	h.reg = reg
+	em.mu.Lock()
+	hs := m[ev]
+	out := make([]*handler, len(hs), len(hs)+1)
+	copy(out, hs)
+	m[ev] = append(out, h)
+	em.mu.Unlock()
+	return reg
+}
+
+// lookup returns the handlers for ev, ordered by priority. Within a
+// priority, handlers registered for the exact name come first, then
+// those for matching patterns, longest prefix first, and finally
+// those registered for "*".
+func (em *Manager) lookup(set *handlerSet, ev string) ([]*handler, []Middleware) {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	var prefixes []string
+	for prefix := range set.patterns {
+		if strings.HasPrefix(ev, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	out := append([]*handler(nil), set.exact[ev]...)
+	for _, prefix := range prefixes {
+		out = append(out, set.patterns[prefix]...)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].priority > out[j].priority })
+	return out, em.middleware
+}
+
+func (em *Manager) dispatch(set *handlerSet, event *Event) {
+	ev := event.Name
+	if event.Cookie != "" {
+		ev = "REQUEST-" + ev
+	}
+	handlers, middleware := em.lookup(set, ev)
+	for _, h := range handlers {
+		if atomic.LoadInt32(&h.removed) != 0 {
+			continue
+		}
+		if h.pred != nil && !h.pred(event) {
+			continue
+		}
+		if h.once {
+			if !atomic.CompareAndSwapInt32(&h.removed, 0, 1) {
+				continue
+			}
+			h.reg.Remove()
+		}
+		fn := h.fn
+		for i := len(middleware) - 1; i >= 0; i-- {
+			fn = middleware[i](fn)
+		}
+		err := fn(event)
+		if err == ErrStopPropagation {
+			return
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package event_manager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// serve feeds lines to em and waits until they have been handled.
+func serve(em *Manager, lines ...string) {
+	em.Serve(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+}
+
+// recorder returns a handler that appends name to calls and returns
+// err.
+func recorder(calls *[]string, name string, err error) Handler {
+	return func(*Event) error {
+		*calls = append(*calls, name)
+		return err
+	}
+}
+
+func TestDispatchOrder(t *testing.T) {
+	type reg struct {
+		name     string
+		ev       string
+		priority int
+		err      error
+	}
+	tests := []struct {
+		desc string
+		regs []reg
+		want string
+	}{
+		{
+			"registration order",
+			[]reg{{"a", "FOO", 0, nil}, {"b", "FOO", 0, nil}, {"c", "FOO", 0, nil}},
+			"a b c",
+		},
+		{
+			"higher priorities first",
+			[]reg{{"a", "FOO", 0, nil}, {"b", "FOO", 10, nil}, {"c", "FOO", -5, nil}, {"d", "FOO", 10, nil}},
+			"b d a c",
+		},
+		{
+			"priority beats exact names",
+			[]reg{{"exact", "FOO", 0, nil}, {"all", "*", 1, nil}},
+			"all exact",
+		},
+		{
+			"stop propagation",
+			[]reg{{"a", "FOO", 0, nil}, {"b", "FOO", 0, ErrStopPropagation}, {"c", "FOO", 0, nil}, {"all", "*", 0, nil}},
+			"a b",
+		},
+		{
+			"stop propagation by priority",
+			[]reg{{"a", "FOO", 0, nil}, {"b", "FOO", 1, ErrStopPropagation}},
+			"b",
+		},
+		{
+			"other errors don't stop propagation",
+			[]reg{{"a", "FOO", 0, errors.New("failed")}, {"b", "FOO", 0, nil}},
+			"a b",
+		},
+		{
+			"other events",
+			[]reg{{"a", "BAR", 0, nil}, {"b", "FOO", 0, nil}},
+			"b",
+		},
+	}
+	for _, tt := range tests {
+		var calls []string
+		em := New(nil)
+		for _, r := range tt.regs {
+			em.AddHandlerPriority(r.ev, r.priority, recorder(&calls, r.name, r.err))
+		}
+		serve(em, "EVENT [1] FOO detail")
+		if got := strings.Join(calls, " "); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ev *Event) error {
+				calls = append(calls, name+" before")
+				err := next(ev)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+	em := New(nil)
+	em.Use(mw("outer"))
+	em.Use(mw("inner"))
+	em.AddHandler("FOO", recorder(&calls, "handler", nil))
+	em.AddImmediateHandler("FOO", recorder(&calls, "immediate", nil))
+	serve(em, "EVENT [1] FOO ")
+
+	want := "outer before, inner before, immediate, inner after, outer after, " +
+		"outer before, inner before, handler, inner after, outer after"
+	if got := strings.Join(calls, ", "); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestMiddlewareStopPropagation(t *testing.T) {
+	var calls []string
+	em := New(nil)
+	em.Use(func(next Handler) Handler {
+		return func(ev *Event) error {
+			next(ev)
+			return ErrStopPropagation
+		}
+	})
+	em.AddHandler("FOO", recorder(&calls, "a", nil))
+	em.AddHandler("FOO", recorder(&calls, "b", nil))
+	serve(em, "EVENT [1] FOO ")
+	if got := strings.Join(calls, " "); got != "a" {
+		t.Errorf("got %q, want %q", got, "a")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var calls []string
+	var errs []error
+	em := New(nil)
+	em.Use(func(next Handler) Handler {
+		return func(ev *Event) error {
+			err := next(ev)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			return err
+		}
+	})
+	em.Use(Recover)
+	em.AddHandler("FOO", func(*Event) error { panic("boom") })
+	em.AddHandler("FOO", recorder(&calls, "after", nil))
+	serve(em, "EVENT [1] FOO ", "EVENT [1] FOO ")
+
+	if got := strings.Join(calls, " "); got != "after after" {
+		t.Errorf("handlers after the panicking one: got %q, want %q", got, "after after")
+	}
+	want := fmt.Sprintf("panic in handler for FOO: %v", "boom")
+	if len(errs) != 2 || errs[0].Error() != want {
+		t.Errorf("got errors %v, want two of %q", errs, want)
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	tests := []struct {
+		ev   string
+		want string
+	}{
+		{"LOAD_START", "exact LOAD_S* LOAD_* * *2"},
+		{"LOAD_FINISH", "LOAD_* * *2"},
+		{"LOAD", "* *2"},
+		{"KEY_PRESS", "* *2"},
+	}
+	for _, tt := range tests {
+		var calls []string
+		em := New(nil)
+		// registered in an order different from the expected one
+		em.AddHandler("*", recorder(&calls, "*", nil))
+		em.AddHandler("LOAD_*", recorder(&calls, "LOAD_*", nil))
+		em.AddHandler("LOAD_S*", recorder(&calls, "LOAD_S*", nil))
+		em.AddHandler("LOAD_START", recorder(&calls, "exact", nil))
+		em.AddHandler("*", recorder(&calls, "*2", nil))
+		serve(em, "EVENT [1] "+tt.ev+" ")
+		if got := strings.Join(calls, " "); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.ev, got, tt.want)
+		}
+	}
+}
+
+func TestPatternMatchesRequests(t *testing.T) {
+	var calls []string
+	em := New(nil)
+	em.AddHandler("REQUEST-*", recorder(&calls, "requests", nil))
+	em.AddHandler("ADBLOCK", recorder(&calls, "event", nil))
+	serve(em, "REQUEST-1 [1] ADBLOCK x", "EVENT [1] ADBLOCK x")
+	if got := strings.Join(calls, " "); got != "requests event" {
+		t.Errorf("got %q, want %q", got, "requests event")
+	}
+}
+
+func TestDetailMatches(t *testing.T) {
+	var got []string
+	em := New(nil)
+	em.AddPredicateHandler("LOAD_*", DetailMatches(regexp.MustCompile(`^'https://`)), func(ev *Event) error {
+		got = append(got, ev.Name+" "+ev.Detail)
+		return nil
+	})
+	serve(em,
+		"EVENT [1] LOAD_START 'https://example.com/'",
+		"EVENT [1] LOAD_START 'http://example.com/'",
+		"EVENT [1] LOAD_FINISH 'https://example.com/'",
+	)
+	want := []string{"LOAD_START 'https://example.com/'", "LOAD_FINISH 'https://example.com/'"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	var calls []string
+	em := New(nil)
+	a := em.AddHandler("FOO", recorder(&calls, "a", nil))
+	em.AddHandler("FOO", recorder(&calls, "b", nil))
+	c := em.AddHandler("FOO", recorder(&calls, "c", nil))
+	serve(em, "EVENT [1] FOO ")
+	a.Remove()
+	c.Remove()
+	c.Remove()
+	serve(em, "EVENT [1] FOO ")
+	if got := strings.Join(calls, " "); got != "a b c b" {
+		t.Errorf("got %q, want %q", got, "a b c b")
+	}
+}
+
+func TestRemoveFromHandler(t *testing.T) {
+	var calls []string
+	em := New(nil)
+	var reg *Registration
+	reg = em.AddHandler("FOO", func(ev *Event) error {
+		calls = append(calls, "self "+ev.Detail)
+		reg.Remove()
+		return nil
+	})
+	var other *Registration
+	em.AddHandler("FOO", func(ev *Event) error {
+		calls = append(calls, "remover "+ev.Detail)
+		other.Remove()
+		return nil
+	})
+	other = em.AddHandler("FOO", recorder(&calls, "other", nil))
+	serve(em, "EVENT [1] FOO 1", "EVENT [1] FOO 2")
+
+	// other is removed before it runs for the first event
+	want := "self 1, remover 1, remover 2"
+	if got := strings.Join(calls, ", "); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// TestConcurrentRegistration adds and removes handlers while events
+// are being dispatched. Run it with -race.
+func TestConcurrentRegistration(t *testing.T) {
+	pr, pw := io.Pipe()
+	em := New(pr)
+	var mu sync.Mutex
+	count := 0
+	inc := func(*Event) error {
+		mu.Lock()
+		count++
+		mu.Unlock()
+		return nil
+	}
+	em.AddHandler("FOO", func(ev *Event) error {
+		// registering from within a handler
+		em.AddHandler("FOO", inc).Remove()
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		em.Listen()
+		close(done)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				reg := em.AddHandler("FOO", inc)
+				em.AddHandlerPriority("F*", j, inc).Remove()
+				em.AddImmediateHandler("FOO", inc)
+				reg.Remove()
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		io.WriteString(pw, "EVENT [1] FOO \n")
+	}
+	wg.Wait()
+	pw.Close()
+	<-done
+}
@@ -0,0 +1,106 @@
+package event_manager
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// A trace consists of one line per raw line read by the manager,
+// prefixed with the time it was read in RFC 3339 format:
+//
+//	2016-01-02T15:04:05.123456789Z EVENT [1234] LOAD_START 'about:blank'
+
+type ErrTraceFormat struct {
+	Line int
+}
+
+func (e ErrTraceFormat) Error() string {
+	return fmt.Sprintf("Malformed trace in line %d", e.Line)
+}
+
+// Record writes every line read by Listen and Serve to w, including
+// lines that aren't valid events. Passing nil stops recording. If
+// writing fails, the error is logged and recording stops.
+func (em *Manager) Record(w io.Writer) {
+	em.traceMu.Lock()
+	defer em.traceMu.Unlock()
+	em.trace = w
+}
+
+func (em *Manager) record(line string) {
+	em.traceMu.Lock()
+	defer em.traceMu.Unlock()
+	if em.trace == nil {
+		return
+	}
+	_, err := fmt.Fprintf(em.trace, "%s %s\n", time.Now().UTC().Format(time.RFC3339Nano), line)
+	if err != nil {
+		log.Println("Error writing trace:", err)
+		em.trace = nil
+	}
+}
+
+// Replay feeds the trace read from r to the handlers, like Serve.
+// Events are delayed according to their recorded times, divided by
+// speed; a speed of 0 replays without delays. Replay returns once
+// the trace has been handled or ctx is done. Replayed lines are not
+// recorded.
+func (em *Manager) Replay(ctx context.Context, r io.Reader, speed float64) error {
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		err := ReplayTo(ctx, r, pw, speed)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+	em.serve(pr, false)
+	pr.Close()
+	return <-errc
+}
+
+// ReplayTo writes the lines of the trace read from r to w, without
+// their times and delayed like in Replay. It allows replaying a
+// trace into anything that reads uzbl-core's output, such as a Uzbl
+// attached to a fake connection.
+func ReplayTo(ctx context.Context, r io.Reader, w io.Writer, speed float64) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	var last time.Time
+	n := 0
+	for sc.Scan() {
+		n++
+		idx := strings.Index(sc.Text(), " ")
+		if idx < 0 {
+			return ErrTraceFormat{n}
+		}
+		t, err := time.Parse(time.RFC3339Nano, sc.Text()[:idx])
+		if err != nil {
+			return ErrTraceFormat{n}
+		}
+		if speed > 0 && !last.IsZero() {
+			d := time.Duration(float64(t.Sub(last)) / speed)
+			if d > 0 {
+				timer := time.NewTimer(d)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+		}
+		last = t
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, sc.Text()[idx+1:]+"\n"); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
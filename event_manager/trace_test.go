@@ -0,0 +1,56 @@
+package event_manager
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+const events = "EVENT [1] LOAD_START 'http://example.com/'\n" +
+	"not an event\n" +
+	"EVENT [1] LOAD_FINISH 'http://example.com/'\n"
+
+func TestRecordReplay(t *testing.T) {
+	var trace bytes.Buffer
+	em := New(strings.NewReader(events))
+	em.Record(&trace)
+	em.Listen()
+
+	lines := strings.Split(strings.TrimSuffix(trace.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines of trace, want 3:\n%s", len(lines), trace.String())
+	}
+	for i, want := range strings.Split(strings.TrimSuffix(events, "\n"), "\n") {
+		if !strings.HasSuffix(lines[i], " "+want) {
+			t.Errorf("line %d: got %q, want it to end in %q", i+1, lines[i], want)
+		}
+	}
+
+	var rerecorded bytes.Buffer
+	em2 := New(nil)
+	em2.Record(&rerecorded)
+	var got []string
+	em2.AddHandler("*", func(ev *Event) error {
+		got = append(got, ev.Name+" "+ev.Detail)
+		return nil
+	})
+	if err := em2.Replay(context.Background(), strings.NewReader(trace.String()), 0); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"LOAD_START 'http://example.com/'", "LOAD_FINISH 'http://example.com/'"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("replayed %q, want %q", got, want)
+	}
+	if rerecorded.Len() != 0 {
+		t.Errorf("replayed events were recorded:\n%s", rerecorded.String())
+	}
+}
+
+func TestReplayMalformed(t *testing.T) {
+	em := New(nil)
+	err := em.Replay(context.Background(), strings.NewReader("yesterday EVENT [1] LOAD_START x\n"), 0)
+	if err != (ErrTraceFormat{1}) {
+		t.Errorf("got %v, want %v", err, ErrTraceFormat{1})
+	}
+}
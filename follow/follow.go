@@ -1,16 +1,26 @@
 package follow // import "honnef.co/go/uzbl/follow"
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/command"
 )
 
+// timeout is how long to wait for the hinting code to respond.
+const timeout = 5 * time.Second
+
 type Follow struct {
 	keymap *uzbl.Keymap
 }
 
+func (f *Follow) Name() string {
+	return "follow"
+}
+
 func (f *Follow) Init(u *uzbl.Uzbl) {
 	f.keymap = &uzbl.Keymap{
 		Prompt:   "Follow:",
@@ -20,43 +30,44 @@ func (f *Follow) Init(u *uzbl.Uzbl) {
 
 	u.AddHandler("LOAD_COMMIT", f.evLoadCommit)
 	u.AddHandler("FOLLOW", f.evFollow)
-	u.AddHandler("FOLLOWING", f.evFollowing)
 }
 
 func (f *Follow) evLoadCommit(ev *uzbl.Event) error {
 	// FIXME relative path
 	// TODO see if we can use a data uri for this
-	ev.Uzbl.Send("js page file /home/dominikh/.config/uzbl/hints.js")
+	ev.Exec(command.JSFile("page", "/home/dominikh/.config/uzbl/hints.js"))
 	return nil
 }
 
 func (f *Follow) evEscape(ev *uzbl.Event) {
-	ev.Uzbl.Send("js page string uzbl.LinkHints.deactivateMode()")
+	ev.Exec(command.JS("page", "uzbl.LinkHints.deactivateMode()"))
 }
 
 func (f *Follow) evKeypress(ev *uzbl.Event, input uzbl.Keys) error {
-	ev.Uzbl.Send(fmt.Sprintf("event FOLLOWING @< uzbl.LinkHints.Blegh('%s') >@", input))
-	return nil
+	return f.hint(ev, input.String())
 }
 
 func (f *Follow) evFollow(ev *uzbl.Event) error {
-	ev.Uzbl.IM.SetKeymap(f.keymap)
-	ev.Uzbl.Send("event FOLLOWING @< uzbl.LinkHints.Blegh('') >@")
-	return nil
+	ev.SetKeymap(f.keymap)
+	return f.hint(ev, "")
 }
 
-func (f *Follow) evFollowing(ev *uzbl.Event) error {
-	parts := strings.SplitN(ev.Detail, " ", 2)
-	if len(parts) == 0 {
-		return nil
+func (f *Follow) hint(ev *uzbl.Event, input string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	res, err := ev.Uzbl.EvalJS(ctx, fmt.Sprintf("uzbl.LinkHints.Blegh(%s)", command.JSString(input)))
+	if err != nil {
+		return err
 	}
+
+	parts := strings.SplitN(res, " ", 2)
 	if parts[0] == "select" || parts[0] == "click" {
-		ev.Uzbl.Send("js page string uzbl.LinkHints.deactivateMode()")
+		ev.Exec(command.JS("page", "uzbl.LinkHints.deactivateMode()"))
 		ev.Uzbl.IM.SetGlobalKeymap()
 	}
 
 	if parts[0] == "select" {
-		ev.Uzbl.Send("event INSERT_MODE")
+		ev.Exec(command.Event("INSERT_MODE"))
 	}
 	return nil
 }
@@ -0,0 +1,35 @@
+package follow_test
+
+import (
+	"testing"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/follow"
+	"honnef.co/go/uzbl/uzbltest"
+)
+
+func TestFollowSelect(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{}, &follow.Follow{})
+	var scripts []string
+	f.EvalJS = func(script string) (string, error) {
+		scripts = append(scripts, script)
+		if script == `uzbl.LinkHints.Blegh("a")` {
+			return "select", nil
+		}
+		return "", nil
+	}
+
+	f.Emit("FOLLOW", "")
+	f.Emit("KEY_PRESS", "'' a")
+	f.ExpectCommand("js page string uzbl.LinkHints.deactivateMode()")
+	f.ExpectCommand("event INSERT_MODE")
+	f.Sync()
+
+	want := []string{`uzbl.LinkHints.Blegh("")`, `uzbl.LinkHints.Blegh("a")`}
+	if len(scripts) != len(want) || scripts[0] != want[0] || scripts[1] != want[1] {
+		t.Errorf("got scripts %q, want %q", scripts, want)
+	}
+	if got := f.Var("forward_keys"); got != "1" {
+		t.Errorf("forward_keys = %q, want 1", got)
+	}
+}
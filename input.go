@@ -2,7 +2,11 @@ package uzbl
 
 import (
 	"fmt"
+	"log"
 	"strings"
+
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/event_manager/events"
 )
 
 type Keys []Key
@@ -63,9 +67,9 @@ func (key Key) String() string {
 	return mods + key.key
 }
 
-func parseMod(s string) int {
+func parseMod(ss []string) int {
 	mods := 0
-	for _, mod := range strings.Split(s, "|") {
+	for _, mod := range ss {
 		switch mod {
 		case "Shift":
 			mods |= shift
@@ -88,6 +92,44 @@ func parseMod(s string) int {
 	return mods
 }
 
+var validMods = map[string]bool{
+	"C": true, "S": true, "1": true, "2": true,
+	"3": true, "4": true, "5": true, "6": true,
+}
+
+// ValidateBind reports problems with a bind that parseBind would
+// otherwise silently accept, such as empty keys, unknown modifiers
+// or a misplaced <*>.
+func ValidateBind(s string) error {
+	keys := strings.Split(s, " ")
+	for i, k := range keys {
+		if k == "" {
+			return fmt.Errorf("bind '%s' contains an empty key", s)
+		}
+		if len(k) > 1 {
+			parts := strings.Split(k, "-")
+			if parts[len(parts)-1] == "" {
+				return fmt.Errorf("bind '%s': key '%s' has modifiers but no key", s, k)
+			}
+			for _, m := range parts[:len(parts)-1] {
+				if !validMods[m] {
+					return fmt.Errorf("bind '%s': unknown modifier '%s'", s, m)
+				}
+			}
+			// a single character, such as in C-< or S->, is always
+			// a valid key
+			key := parts[len(parts)-1]
+			if len(key) > 1 && strings.HasPrefix(key, "<") != strings.HasSuffix(key, ">") {
+				return fmt.Errorf("bind '%s': unbalanced <> in key '%s'", s, key)
+			}
+		}
+		if k == "<*>" && i != len(keys)-1 {
+			return fmt.Errorf("bind '%s': <*> must be the last key", s)
+		}
+	}
+	return nil
+}
+
 func parseBind(s string) *keyBind {
 	bind := &keyBind{}
 	var keys Keys
@@ -191,13 +233,19 @@ type InputManager struct {
 	activeKeymap *Keymap
 	input        Keys
 	mode         int
+	// keymapOwner is the plugin that activated the active keymap
+	keymapOwner string
+}
+
+func (im *InputManager) exec(cmds ...command.Command) error {
+	return im.uzbl.exec("input", cmds)
 }
 
 func (im *InputManager) evRootActive(*Event) error {
 	// FIXME there seems to be a bug in uzbl that triggers a
 	// FOCUS_ELEMENT right after the first ROOT_ACTIVE.
 	im.mode = commandMode
-	im.uzbl.Send("set forward_keys 0")
+	im.exec(command.Set("forward_keys", "0"))
 	im.setModeIndicator()
 	return nil
 }
@@ -221,20 +269,23 @@ func (im *InputManager) evFocusElement(ev *Event) error {
 
 func (im *InputManager) evLoadStart(*Event) error {
 	im.mode = commandMode
-	im.uzbl.Send("set forward_keys 0")
+	im.exec(command.Set("forward_keys", "0"))
 	im.setModeIndicator()
 	return nil
 }
 
 func (im *InputManager) evKeyPress(ev *Event) error {
-	parts := ev.ParseDetail(2)
-	mods, key := parseMod(parts[0]), parts[1]
+	k, err := events.DecodeKey(ev.Event)
+	if err != nil {
+		return err
+	}
+	mods, key := parseMod(k.Mods), k.Key
 	if len(key) == 1 {
 		mods &^= shift
 	}
 
 	if key == "Escape" {
-		im.uzbl.Send("event ESCAPE")
+		im.exec(command.Event("ESCAPE"))
 		return nil
 	}
 
@@ -275,7 +326,6 @@ func (im *InputManager) evKeyPress(ev *Event) error {
 		return nil
 	}
 
-	var err error
 	if bind.incremental {
 		err = bind.fn(ev, im.input[len(bind.bind)-1:])
 	} else {
@@ -297,17 +347,15 @@ func (im *InputManager) setKeycmd() {
 	} else {
 		chain = im.input.String()
 	}
-	chain = strings.Replace(chain, " ", "\\ ", -1)
-	im.uzbl.Send(fmt.Sprintf("set keycmd %s", chain))
+	im.exec(command.Set("keycmd", chain))
 }
 
 func (im *InputManager) setPrompt() {
 	if im.activeKeymap.Prompt == "" {
-		im.uzbl.Send(fmt.Sprintf("set keycmd_prompt "))
+		im.exec(command.Set("keycmd_prompt", ""))
 		return
 	}
-	prompt := im.activeKeymap.Prompt + `\ `
-	im.uzbl.Send(fmt.Sprintf("set keycmd_prompt %s", prompt))
+	im.exec(command.Set("keycmd_prompt", im.activeKeymap.Prompt+" "))
 }
 
 func (im *InputManager) setModeIndicator() {
@@ -320,18 +368,22 @@ func (im *InputManager) setModeIndicator() {
 	default:
 		name = "Error!"
 	}
-	im.uzbl.Send(fmt.Sprintf("set mode_indicator %s", name))
+	im.exec(command.Set("mode_indicator", name))
 }
 
 func (im *InputManager) evBind(ev *Event) error {
 	args := ev.ParseDetail(3)
+	if err := ValidateBind(args[0]); err != nil {
+		// uzbl-lint reports these; the bind is kept as before
+		log.Println(err)
+	}
 	im.globalKeymap.Bind(args[0], im.uzbl.CommandFn(args[1])) // TODO repeat
 	return nil
 }
 
 func (im *InputManager) evInsertMode(ev *Event) error {
 	im.mode = insertMode
-	im.uzbl.Send("set forward_keys 1")
+	im.exec(command.Set("forward_keys", "1"))
 	im.setModeIndicator()
 	return nil
 }
@@ -343,7 +395,7 @@ func (im *InputManager) evEscape(ev *Event) error {
 	// TODO move this into an OnEscape, too?
 	im.SetGlobalKeymap()
 	im.mode = commandMode
-	im.uzbl.Send("set forward_keys 0")
+	im.exec(command.Set("forward_keys", "0"))
 	im.setModeIndicator()
 	return nil
 }
@@ -353,8 +405,23 @@ func (im *InputManager) evInstanceStart(ev *Event) error {
 	return nil
 }
 
+// reset discards all binds and input state, in preparation for the
+// config being replayed.
+func (im *InputManager) reset() {
+	im.globalKeymap.binds = nil
+	im.activeKeymap = im.globalKeymap
+	im.keymapOwner = ""
+	im.input = nil
+	im.mode = commandMode
+}
+
 func (im *InputManager) SetKeymap(k *Keymap) {
+	im.setKeymap(k, "")
+}
+
+func (im *InputManager) setKeymap(k *Keymap, owner string) {
 	im.activeKeymap = k
+	im.keymapOwner = owner
 	im.ClearInput()
 	im.setPrompt()
 }
@@ -0,0 +1,77 @@
+package uzbl_test
+
+import (
+	"testing"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/uzbltest"
+)
+
+func TestBindKeyPress(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{})
+	f.Emit("BIND", `'g h' 'uri http://example.com/'`)
+	f.Emit("KEY_PRESS", "'' g")
+	if got := f.Var("keycmd"); got != "g" {
+		t.Errorf("keycmd = %q, want g", got)
+	}
+	f.Emit("KEY_PRESS", "'' h")
+	f.ExpectCommand("uri http://example.com/")
+	if got := f.Var("keycmd"); got != "" {
+		t.Errorf("keycmd = %q after bind, want it cleared", got)
+	}
+}
+
+func TestInsertMode(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{})
+	f.Emit("BIND", `x 'uri http://example.com/'`)
+	f.Emit("INSERT_MODE", "")
+	f.Emit("KEY_PRESS", "'' x")
+	f.Emit("KEY_PRESS", "'' Escape")
+	f.Emit("KEY_PRESS", "'' x")
+	f.ExpectCommand("uri http://example.com/")
+	if n := count(f.Commands(), "uri http://example.com/"); n != 1 {
+		t.Errorf("bind ran %d times, want once", n)
+	}
+}
+
+func count(cmds []string, cmd string) int {
+	n := 0
+	for _, c := range cmds {
+		if c == cmd {
+			n++
+		}
+	}
+	return n
+}
+
+func TestValidateBind(t *testing.T) {
+	tests := []struct {
+		bind string
+		ok   bool
+	}{
+		{"g g", true},
+		{"C-a", true},
+		{"C-<", true},
+		{"S->", true},
+		{"C-S-<Return>", true},
+		{"o <*>", true},
+		{"g  g", false},
+		{"C-", false},
+		{"X-a", false},
+		{"C-<Return", false},
+		{"<*> o", false},
+	}
+	for _, tt := range tests {
+		err := uzbl.ValidateBind(tt.bind)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateBind(%q) = %v, want ok = %t", tt.bind, err, tt.ok)
+		}
+	}
+}
+
+func TestInvalidBindIsKept(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{})
+	f.Emit("BIND", `'X-x' 'uri http://example.com/'`)
+	f.Emit("KEY_PRESS", "'' x")
+	f.ExpectCommand("uri http://example.com/")
+}
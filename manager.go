@@ -0,0 +1,214 @@
+package uzbl
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// Instance is an instance of uzbl-core managed by a Manager.
+type Instance struct {
+	ID   int
+	Uzbl *Uzbl
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Manager runs and tracks several instances of uzbl-core, for
+// example to implement tabs. Each instance gets its own set of
+// plugins.
+type Manager struct {
+	opts     Options
+	plugins  func() []Registerable
+	handlers []managerHandler
+
+	mu        sync.Mutex
+	nextID    int
+	instances map[int]*Instance
+	// closed maps IDs of closed instances to their last URI
+	closed  map[int]string
+	focused int
+}
+
+type managerHandler struct {
+	ev string
+	fn Handler
+}
+
+// NewManager returns a Manager that launches instances with opts
+// and the plugins returned by calling plugins for every instance.
+func NewManager(opts Options, plugins func() []Registerable) *Manager {
+	return &Manager{
+		opts:      opts,
+		plugins:   plugins,
+		instances: make(map[int]*Instance),
+		closed:    make(map[int]string),
+		focused:   -1,
+	}
+}
+
+// AddHandler registers fn for ev on all instances. It must be called
+// before the first instance is opened.
+func (m *Manager) AddHandler(ev string, fn Handler) {
+	m.handlers = append(m.handlers, managerHandler{ev, fn})
+}
+
+// managerPlugin connects an instance to its Manager.
+type managerPlugin struct {
+	m  *Manager
+	id int
+}
+
+func (p *managerPlugin) Name() string {
+	return "manager"
+}
+
+func (p *managerPlugin) Init(u *Uzbl) {
+	u.AddHandler("FOCUS_GAINED", p.evFocusGained)
+	u.AddHandler("FOCUS_LOST", p.evFocusLost)
+	for _, h := range p.m.handlers {
+		u.AddHandler(h.ev, h.fn)
+	}
+}
+
+func (p *managerPlugin) evFocusGained(ev *Event) error {
+	p.m.mu.Lock()
+	p.m.focused = p.id
+	p.m.mu.Unlock()
+	return nil
+}
+
+func (p *managerPlugin) evFocusLost(ev *Event) error {
+	p.m.mu.Lock()
+	if p.m.focused == p.id {
+		p.m.focused = -1
+	}
+	p.m.mu.Unlock()
+	return nil
+}
+
+// Open launches a new instance that loads uri.
+func (m *Manager) Open(uri string) *Instance {
+	m.mu.Lock()
+	id := m.nextID
+	m.nextID++
+	m.mu.Unlock()
+	return m.open(id, uri)
+}
+
+func (m *Manager) open(id int, uri string) *Instance {
+	opts := m.opts
+	opts.URI = uri
+	u := New(opts)
+	u.manager = m
+	u.Register(&managerPlugin{m, id})
+	if m.plugins != nil {
+		u.Register(m.plugins()...)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	inst := &Instance{ID: id, Uzbl: u, cancel: cancel, done: make(chan struct{})}
+	m.mu.Lock()
+	m.instances[id] = inst
+	delete(m.closed, id)
+	m.mu.Unlock()
+
+	go func() {
+		defer close(inst.done)
+		err := u.Run(ctx)
+		if err != nil && err != context.Canceled {
+			log.Printf("instance %d: %s", id, err)
+		}
+
+		m.mu.Lock()
+		delete(m.instances, id)
+		m.closed[id] = u.URI()
+		if m.focused == id {
+			m.focused = -1
+		}
+		m.mu.Unlock()
+	}()
+	return inst
+}
+
+// Get returns the instance with the given ID, or nil if there is no
+// such instance.
+func (m *Manager) Get(id int) *Instance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.instances[id]
+}
+
+// List returns all running instances, ordered by ID.
+func (m *Manager) List() []*Instance {
+	m.mu.Lock()
+	out := make([]*Instance, 0, len(m.instances))
+	for _, inst := range m.instances {
+		out = append(out, inst)
+	}
+	m.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Focused returns the instance that has the input focus, or nil if
+// none has.
+func (m *Manager) Focused() *Instance {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.instances[m.focused]
+}
+
+// Close shuts down the instance with the given ID and waits for it
+// to exit. It must not be called from the instance's own handlers,
+// such as a bind closing the current tab: the instance can't exit
+// before the handler returns, so Close would never return. Use
+// Instance.Close there instead.
+func (m *Manager) Close(id int) error {
+	inst := m.Get(id)
+	if inst == nil {
+		return fmt.Errorf("no instance with ID %d", id)
+	}
+	inst.cancel()
+	<-inst.done
+	return nil
+}
+
+// Reopen launches a closed instance again, with the same ID and its
+// last URI.
+func (m *Manager) Reopen(id int) (*Instance, error) {
+	m.mu.Lock()
+	uri, ok := m.closed[id]
+	delete(m.closed, id)
+	m.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no closed instance with ID %d", id)
+	}
+	if uri == "" {
+		uri = m.opts.URI
+	}
+	return m.open(id, uri), nil
+}
+
+// Shutdown closes all instances and waits for them to exit. Like
+// Close, it must not be called from a handler.
+func (m *Manager) Shutdown() {
+	for _, inst := range m.List() {
+		inst.cancel()
+		<-inst.done
+	}
+}
+
+// Close shuts down the instance without waiting for it to exit. It
+// may be called from the instance's own handlers.
+func (inst *Instance) Close() {
+	inst.cancel()
+}
+
+// Wait blocks until the instance has exited.
+func (inst *Instance) Wait() {
+	<-inst.done
+}
@@ -0,0 +1,201 @@
+package uzbl_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/command"
+)
+
+// stubCore is a minimal uzbl-core: it reports the URI it was started
+// with, echoes event commands back as events, unescaping \@ but
+// performing no expansions, emits VARIABLE_SET for simple set
+// commands and exits on exit.
+const stubCore = `#!/bin/sh
+uri=
+while [ $# -gt 0 ]; do
+	case $1 in
+	--uri) uri=$2; shift ;;
+	esac
+	shift
+done
+[ -n "$uri" ] && echo "EVENT [$$] LOAD_COMMIT '$uri'"
+while IFS= read -r line; do
+	case $line in
+	exit) exit 0 ;;
+	"set "*" "*)
+		var=${line#set }
+		echo "EVENT [$$] VARIABLE_SET ${var%% *} str '${var#* }'"
+		;;
+	"event "*)
+		ev=$(printf '%s\n' "${line#event }" | sed 's/\\@/@/g')
+		case $ev in
+		*" "*) echo "EVENT [$$] $ev" ;;
+		*) echo "EVENT [$$] $ev " ;;
+		esac
+		;;
+	esac
+done
+`
+
+type managerEvent struct {
+	u      *uzbl.Uzbl
+	detail string
+}
+
+// stubOptions returns options for running stubCore with config.
+func stubOptions(t *testing.T, config string) uzbl.Options {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "uzbl-core")
+	if err := os.WriteFile(bin, []byte(stubCore), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := filepath.Join(dir, "config")
+	if err := os.WriteFile(cfg, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return uzbl.Options{Binary: bin, Config: cfg}
+}
+
+func newTestManager(t *testing.T) (*uzbl.Manager, map[string]chan managerEvent) {
+	m := uzbl.NewManager(stubOptions(t, ""), nil)
+	chans := make(map[string]chan managerEvent)
+	for _, name := range []string{"LOAD_COMMIT", "FOCUS_GAINED", "FOCUS_LOST", "PING"} {
+		ch := make(chan managerEvent, 10)
+		chans[name] = ch
+		m.AddHandler(name, func(ev *uzbl.Event) error {
+			ch <- managerEvent{ev.Uzbl, ev.Detail}
+			return nil
+		})
+	}
+	t.Cleanup(m.Shutdown)
+	return m, chans
+}
+
+func expectEvent(t *testing.T, ch chan managerEvent, inst *uzbl.Instance, detail string) {
+	t.Helper()
+	select {
+	case ev := <-ch:
+		if ev.u != inst.Uzbl || ev.detail != detail {
+			t.Fatalf("got %q in %p, want %q in instance %d (%p)", ev.detail, ev.u, detail, inst.ID, inst.Uzbl)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %q in instance %d", detail, inst.ID)
+	}
+}
+
+func TestManager(t *testing.T) {
+	m, chans := newTestManager(t)
+	a := m.Open("http://a.example/")
+	expectEvent(t, chans["LOAD_COMMIT"], a, "'http://a.example/'")
+	b := m.Open("http://b.example/")
+	expectEvent(t, chans["LOAD_COMMIT"], b, "'http://b.example/'")
+
+	if l := m.List(); len(l) != 2 || l[0] != a || l[1] != b {
+		t.Fatalf("List() = %v, want [%d %d]", l, a.ID, b.ID)
+	}
+	if m.Get(b.ID) != b {
+		t.Fatalf("Get(%d) didn't return the instance", b.ID)
+	}
+
+	if m.Focused() != nil {
+		t.Fatal("an instance is focused before any gained focus")
+	}
+	b.Uzbl.Exec(command.Event("FOCUS_GAINED"))
+	expectEvent(t, chans["FOCUS_GAINED"], b, "")
+	if m.Focused() != b {
+		t.Fatalf("Focused() = %v, want instance %d", m.Focused(), b.ID)
+	}
+	b.Uzbl.Exec(command.Event("FOCUS_LOST"))
+	expectEvent(t, chans["FOCUS_LOST"], b, "")
+	if m.Focused() != nil {
+		t.Fatalf("Focused() = %v after losing focus, want nil", m.Focused())
+	}
+
+	if err := m.Broadcast("PING", "hello @uri"); err != nil {
+		t.Fatal(err)
+	}
+	seen := map[*uzbl.Uzbl]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case ev := <-chans["PING"]:
+			if ev.detail != "hello @uri" {
+				t.Errorf("got detail %q, want %q", ev.detail, "hello @uri")
+			}
+			seen[ev.u] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for broadcast")
+		}
+	}
+	if !seen[a.Uzbl] || !seen[b.Uzbl] {
+		t.Errorf("broadcast didn't reach all instances")
+	}
+}
+
+func TestManagerCloseReopen(t *testing.T) {
+	m, chans := newTestManager(t)
+	a := m.Open("http://a.example/")
+	expectEvent(t, chans["LOAD_COMMIT"], a, "'http://a.example/'")
+	a.Uzbl.Exec(command.Event("FOCUS_GAINED"))
+	expectEvent(t, chans["FOCUS_GAINED"], a, "")
+
+	if err := m.Close(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if m.Get(a.ID) != nil || len(m.List()) != 0 {
+		t.Fatal("closed instance is still listed")
+	}
+	if m.Focused() != nil {
+		t.Fatal("closed instance is still focused")
+	}
+	if err := m.Close(a.ID); err == nil {
+		t.Fatal("closing a closed instance succeeded")
+	}
+
+	r, err := m.Reopen(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != a.ID {
+		t.Fatalf("reopened instance has ID %d, want %d", r.ID, a.ID)
+	}
+	expectEvent(t, chans["LOAD_COMMIT"], r, "'http://a.example/'")
+	if m.Get(a.ID) != r {
+		t.Fatal("reopened instance isn't listed")
+	}
+	if _, err := m.Reopen(a.ID); err == nil {
+		t.Fatal("reopening a running instance succeeded")
+	}
+}
+
+func TestCloseFromHandler(t *testing.T) {
+	m, chans := newTestManager(t)
+	m.AddHandler("CLOSE_TAB", func(ev *uzbl.Event) error {
+		for _, inst := range m.List() {
+			if inst.Uzbl == ev.Uzbl {
+				inst.Close()
+			}
+		}
+		return nil
+	})
+	a := m.Open("http://a.example/")
+	expectEvent(t, chans["LOAD_COMMIT"], a, "'http://a.example/'")
+	a.Uzbl.Exec(command.Event("CLOSE_TAB"))
+
+	done := make(chan struct{})
+	go func() {
+		a.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("instance didn't exit after being closed from a handler")
+	}
+	if m.Get(a.ID) != nil {
+		t.Error("closed instance is still listed")
+	}
+}
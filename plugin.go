@@ -0,0 +1,323 @@
+package uzbl
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/event_manager"
+)
+
+// Named is implemented by plugins that have a name. Other plugins
+// are named after their type, e.g. "*progress.Bar".
+type Named interface {
+	Name() string
+}
+
+// Dependent is implemented by plugins that depend on other plugins.
+// Depends returns the names of the plugins that have to be
+// initialized first.
+type Dependent interface {
+	Depends() []string
+}
+
+// EventDependent is implemented by plugins that depend on events
+// being handled by other plugins or by Uzbl itself, for example a
+// plugin that emits FOLLOW and relies on another plugin to act on
+// it. Run fails if no other plugin and no builtin handler is
+// registered for exactly one of the names returned by
+// DependsOnEvents once all plugins have been initialized.
+type EventDependent interface {
+	DependsOnEvents() []string
+}
+
+// Configurable is implemented by plugins that need to run after the
+// config has been loaded. Configure is called once uzbl-core has
+// processed the config and the events it caused have been handled,
+// so variables set by the config are available. Like a handler, it
+// doesn't run concurrently with other handlers.
+type Configurable interface {
+	Configure(*Uzbl) error
+}
+
+// PluginName returns the name of a plugin.
+func PluginName(r Registerable) string {
+	if n, ok := r.(Named); ok {
+		return n.Name()
+	}
+	return fmt.Sprintf("%T", r)
+}
+
+type ErrMissingDependency struct {
+	Plugin     string
+	Dependency string
+}
+
+func (e ErrMissingDependency) Error() string {
+	return fmt.Sprintf("Plugin '%s' depends on missing plugin '%s'", e.Plugin, e.Dependency)
+}
+
+type ErrDependencyCycle struct {
+	Plugins []string
+}
+
+func (e ErrDependencyCycle) Error() string {
+	return fmt.Sprintf("Dependency cycle between plugins: %s", strings.Join(e.Plugins, " -> "))
+}
+
+type ErrUnhandledEvent struct {
+	Plugin string
+	Event  string
+}
+
+func (e ErrUnhandledEvent) Error() string {
+	return fmt.Sprintf("Plugin '%s' depends on event '%s', which nothing else handles", e.Plugin, e.Event)
+}
+
+type ErrDuplicatePlugin struct {
+	Name string
+}
+
+func (e ErrDuplicatePlugin) Error() string {
+	return fmt.Sprintf("Plugin '%s' registered more than once", e.Name)
+}
+
+// resolvePlugins orders plugins so that every plugin comes after its
+// dependencies. Otherwise, the order of registration is preserved.
+func resolvePlugins(plugins []Registerable) ([]Registerable, error) {
+	byName := make(map[string]Registerable, len(plugins))
+	for _, p := range plugins {
+		name := PluginName(p)
+		if _, ok := byName[name]; ok {
+			return nil, ErrDuplicatePlugin{name}
+		}
+		byName[name] = p
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(plugins))
+	var out []Registerable
+	var stack []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, n := range stack {
+				if n == name {
+					return ErrDependencyCycle{append(stack[i:], name)}
+				}
+			}
+		}
+		state[name] = visiting
+		stack = append(stack, name)
+		p := byName[name]
+		if d, ok := p.(Dependent); ok {
+			for _, dep := range d.Depends() {
+				if _, ok := byName[dep]; !ok {
+					return ErrMissingDependency{name, dep}
+				}
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		out = append(out, p)
+		return nil
+	}
+
+	for _, p := range plugins {
+		if err := visit(PluginName(p)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+type ErrUnknownPlugin struct {
+	Name string
+}
+
+func (e ErrUnknownPlugin) Error() string {
+	return fmt.Sprintf("Unknown plugin '%s'", e.Name)
+}
+
+// EnablePlugin re-enables a plugin that has been disabled with
+// DisablePlugin. Like the PLUGIN_ENABLE event it emits, it takes
+// effect once uzbl-core has echoed the event.
+func (u *Uzbl) EnablePlugin(name string) error {
+	return u.Exec(command.Event("PLUGIN_ENABLE", name))
+}
+
+// DisablePlugin disables a plugin by emitting PLUGIN_DISABLE. A
+// disabled plugin's handlers aren't called and a keymap it activated
+// with Event.SetKeymap is deactivated.
+//
+// Only handlers registered during the plugin's Init are gated,
+// including those registered through Events. Handlers the plugin adds
+// later, for example with Once from within another handler, don't
+// belong to any plugin and keep running.
+func (u *Uzbl) DisablePlugin(name string) error {
+	return u.Exec(command.Event("PLUGIN_DISABLE", name))
+}
+
+// ReloadPlugin reloads a plugin by emitting PLUGIN_RELOAD. The
+// handlers registered during its Init are removed, its keymap is
+// deactivated, and Close, Init and Configure are called again, as
+// far as the plugin implements them. Whether the plugin is enabled
+// doesn't change.
+func (u *Uzbl) ReloadPlugin(name string) error {
+	return u.Exec(command.Event("PLUGIN_RELOAD", name))
+}
+
+// PluginEnabled reports whether the named plugin is enabled.
+func (u *Uzbl) PluginEnabled(name string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return !u.disabled[name]
+}
+
+func (u *Uzbl) findPlugin(name string) (Registerable, bool) {
+	for _, p := range u.plugins {
+		if PluginName(p) == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func (u *Uzbl) setPluginEnabled(name string, enabled bool) error {
+	if _, ok := u.findPlugin(name); !ok {
+		return ErrUnknownPlugin{name}
+	}
+	u.mu.Lock()
+	if enabled {
+		delete(u.disabled, name)
+	} else {
+		u.disabled[name] = true
+	}
+	u.mu.Unlock()
+	return nil
+}
+
+func (u *Uzbl) evPluginEnable(ev *Event) error {
+	return u.setPluginEnabled(ev.ParseDetail(1)[0], true)
+}
+
+func (u *Uzbl) evPluginDisable(ev *Event) error {
+	name := ev.ParseDetail(1)[0]
+	if err := u.setPluginEnabled(name, false); err != nil {
+		return err
+	}
+	if u.IM.keymapOwner == name {
+		u.IM.SetGlobalKeymap()
+	}
+	return nil
+}
+
+func (u *Uzbl) evPluginReload(ev *Event) error {
+	name := ev.ParseDetail(1)[0]
+	p, ok := u.findPlugin(name)
+	if !ok {
+		return ErrUnknownPlugin{name}
+	}
+	if u.IM.keymapOwner == name {
+		u.IM.SetGlobalKeymap()
+	}
+	if c, ok := p.(Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Printf("error closing %s: %s", name, err)
+		}
+	}
+	u.mu.Lock()
+	regs := u.registrations[name]
+	delete(u.registrations, name)
+	u.mu.Unlock()
+	for _, reg := range regs {
+		reg.Remove()
+	}
+
+	u.initPlugin(p)
+	if c, ok := p.(Configurable); ok {
+		if err := c.Configure(u); err != nil {
+			log.Printf("error configuring %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// checkEventDependencies checks that the events plugins depend on
+// are handled by someone other than the plugins themselves.
+func (u *Uzbl) checkEventDependencies() error {
+	for _, p := range u.plugins {
+		d, ok := p.(EventDependent)
+		if !ok {
+			continue
+		}
+		name := PluginName(p)
+		u.mu.Lock()
+		own := make(map[*event_manager.Registration]bool)
+		for _, reg := range u.registrations[name] {
+			own[reg] = true
+		}
+		u.mu.Unlock()
+		for _, ev := range d.DependsOnEvents() {
+			handled := false
+			for _, reg := range u.em.Registrations(ev) {
+				if !own[reg] {
+					handled = true
+					break
+				}
+			}
+			if !handled {
+				return ErrUnhandledEvent{name, ev}
+			}
+		}
+	}
+	return nil
+}
+
+// initPlugin calls p's Init, attributing the handlers it registers
+// to p.
+func (u *Uzbl) initPlugin(p Registerable) {
+	u.mu.Lock()
+	u.source = PluginName(p)
+	u.mu.Unlock()
+	p.Init(u)
+	u.mu.Lock()
+	u.source = ""
+	u.mu.Unlock()
+}
+
+// track remembers reg as belonging to the plugin currently being
+// initialized, if any.
+func (u *Uzbl) track(reg *event_manager.Registration) *event_manager.Registration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.source != "" {
+		u.registrations[u.source] = append(u.registrations[u.source], reg)
+	}
+	return reg
+}
+
+// evPluginList stores the names of all plugins in the plugin_list
+// variable, marking disabled ones with a leading -.
+func (u *Uzbl) evPluginList(ev *Event) error {
+	names := make([]string, len(u.plugins))
+	for i, p := range u.plugins {
+		names[i] = PluginName(p)
+		if !u.PluginEnabled(names[i]) {
+			names[i] = "-" + names[i]
+		}
+	}
+	return ev.Exec(command.Set("plugin_list", strings.Join(names, " ")))
+}
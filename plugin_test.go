@@ -0,0 +1,245 @@
+package uzbl_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/uzbltest"
+)
+
+type configurePlugin struct {
+	homePage chan string
+}
+
+func (p *configurePlugin) Init(*uzbl.Uzbl) {}
+
+func (p *configurePlugin) Configure(u *uzbl.Uzbl) error {
+	p.homePage <- u.Variables.GetString("home_page", "")
+	return nil
+}
+
+func TestConfigureAfterConfig(t *testing.T) {
+	u := uzbl.New(stubOptions(t, "set home_page http://example.com/\n"))
+	p := &configurePlugin{make(chan string, 1)}
+	u.Register(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- u.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	select {
+	case got := <-p.homePage:
+		if got != "http://example.com/" {
+			t.Errorf("home_page = %q during Configure, want %q", got, "http://example.com/")
+		}
+	case err := <-done:
+		t.Fatalf("Run returned early: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Configure wasn't called")
+	}
+}
+
+type reloadPlugin struct {
+	inits   int
+	closes  int
+	handled int
+}
+
+func (p *reloadPlugin) Name() string { return "reload" }
+
+func (p *reloadPlugin) Init(u *uzbl.Uzbl) {
+	p.inits++
+	u.AddHandler("PING", func(*uzbl.Event) error {
+		p.handled++
+		return nil
+	})
+}
+
+func (p *reloadPlugin) Close() error {
+	p.closes++
+	return nil
+}
+
+func TestReloadPlugin(t *testing.T) {
+	p := &reloadPlugin{}
+	f := uzbltest.New(t, uzbl.Options{}, p)
+	f.Uzbl.ReloadPlugin("reload")
+	f.Sync()
+	if p.inits != 2 || p.closes != 1 {
+		t.Fatalf("got %d inits and %d closes, want 2 and 1", p.inits, p.closes)
+	}
+
+	// the handler registered by the first Init must be gone
+	f.Emit("PING", "")
+	if p.handled != 1 {
+		t.Errorf("handler ran %d times, want once", p.handled)
+	}
+
+	f.Uzbl.DisablePlugin("reload")
+	f.Uzbl.ReloadPlugin("reload")
+	f.Sync()
+	f.Emit("PING", "")
+	if p.handled != 1 {
+		t.Errorf("handler of a disabled plugin ran after reloading it")
+	}
+}
+
+type slowConfigurePlugin struct {
+	started chan struct{}
+	done    chan struct{}
+}
+
+func (p *slowConfigurePlugin) Init(*uzbl.Uzbl) {}
+
+func (p *slowConfigurePlugin) Configure(u *uzbl.Uzbl) error {
+	close(p.started)
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		u.Variables.GetString("title", "")
+	}
+	close(p.done)
+	return nil
+}
+
+// TestConfigureDoesNotRace checks that handlers don't run while a
+// plugin is being configured. Run it with -race.
+func TestConfigureDoesNotRace(t *testing.T) {
+	p := &slowConfigurePlugin{make(chan struct{}), make(chan struct{})}
+	f := uzbltest.New(t, uzbl.Options{}, p)
+	var during bool
+	f.Uzbl.AddHandler("VARIABLE_SET", func(*uzbl.Event) error {
+		select {
+		case <-p.done:
+		default:
+			during = true
+		}
+		return nil
+	})
+
+	select {
+	case <-p.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Configure wasn't called")
+	}
+	for i := 0; i < 10; i++ {
+		f.EmitLine(fmt.Sprintf("EVENT [%d] VARIABLE_SET title str 'title %d'", uzbltest.PID, i))
+	}
+	f.Sync()
+	if during {
+		t.Error("a handler ran while Configure was running")
+	}
+}
+
+type closePlugin struct {
+	started chan struct{}
+	mu      sync.Mutex
+	running bool
+	overlap bool
+}
+
+func (p *closePlugin) Init(u *uzbl.Uzbl) {
+	u.AddHandler("SLOW", func(*uzbl.Event) error {
+		p.mu.Lock()
+		p.running = true
+		p.mu.Unlock()
+		close(p.started)
+		time.Sleep(50 * time.Millisecond)
+		p.mu.Lock()
+		p.running = false
+		p.mu.Unlock()
+		return nil
+	})
+}
+
+func (p *closePlugin) Close() error {
+	p.mu.Lock()
+	p.overlap = p.running
+	p.mu.Unlock()
+	return nil
+}
+
+func TestCloseAfterHandlers(t *testing.T) {
+	p := &closePlugin{started: make(chan struct{})}
+	f := uzbltest.New(t, uzbl.Options{}, p)
+	f.EmitLine(fmt.Sprintf("EVENT [%d] SLOW ", uzbltest.PID))
+	select {
+	case <-p.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler wasn't called")
+	}
+	f.Close()
+	if p.overlap {
+		t.Error("plugin was closed while its handler was running")
+	}
+}
+
+type eventDependentPlugin struct {
+	name   string
+	events []string
+	// handles are events the plugin handles itself
+	handles []string
+}
+
+func (p *eventDependentPlugin) Name() string { return p.name }
+
+func (p *eventDependentPlugin) Init(u *uzbl.Uzbl) {
+	for _, ev := range p.handles {
+		u.AddHandler(ev, func(*uzbl.Event) error { return nil })
+	}
+}
+
+func (p *eventDependentPlugin) DependsOnEvents() []string { return p.events }
+
+func TestEventDependencies(t *testing.T) {
+	tests := []struct {
+		desc    string
+		plugins []uzbl.Registerable
+		err     error
+	}{
+		{
+			"handled by another plugin",
+			[]uzbl.Registerable{
+				&eventDependentPlugin{name: "emitter", events: []string{"FOLLOW"}},
+				&eventDependentPlugin{name: "follow", handles: []string{"FOLLOW"}},
+			},
+			nil,
+		},
+		{
+			"handled by a builtin",
+			[]uzbl.Registerable{&eventDependentPlugin{name: "binder", events: []string{"BIND"}}},
+			nil,
+		},
+		{
+			"not handled",
+			[]uzbl.Registerable{&eventDependentPlugin{name: "emitter", events: []string{"FOLLOW"}}},
+			uzbl.ErrUnhandledEvent{Plugin: "emitter", Event: "FOLLOW"},
+		},
+		{
+			"only handled by the plugin itself",
+			[]uzbl.Registerable{&eventDependentPlugin{name: "self", events: []string{"FOLLOW"}, handles: []string{"FOLLOW"}}},
+			uzbl.ErrUnhandledEvent{Plugin: "self", Event: "FOLLOW"},
+		},
+	}
+	for _, tt := range tests {
+		u := uzbl.New(uzbl.Options{Binary: "/nonexistent/uzbl-core"})
+		u.Register(tt.plugins...)
+		err := u.Run(context.Background())
+		if tt.err != nil {
+			if err != tt.err {
+				t.Errorf("%s: got %v, want %v", tt.desc, err, tt.err)
+			}
+			continue
+		}
+		if _, ok := err.(uzbl.ErrUnhandledEvent); ok {
+			t.Errorf("%s: unexpected error %v", tt.desc, err)
+		}
+	}
+}
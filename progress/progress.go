@@ -1,17 +1,22 @@
 package progress // import "honnef.co/go/uzbl/progress"
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
 
 	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/event_manager/events"
 )
 
 type Bar struct {
 	updates int
 }
 
+func (p *Bar) Name() string {
+	return "progress"
+}
+
 func (p *Bar) Init(u *uzbl.Uzbl) {
 	u.AddHandler("LOAD_COMMIT", p.evLoadCommit)
 	u.AddHandler("LOAD_PROGRESS", p.evLoadProgress)
@@ -20,31 +25,28 @@ func (p *Bar) Init(u *uzbl.Uzbl) {
 }
 
 func (p *Bar) evLoadFinish(ev *uzbl.Event) error {
-	ev.Uzbl.Send(`set status_message <span foreground="gold">done</span>`)
+	ev.Exec(command.Set("status_message", `<span foreground="gold">done</span>`))
 	return nil
 }
 
 func (p *Bar) evLoadStart(ev *uzbl.Event) error {
-	ev.Uzbl.Send(`set status_message <span foreground="khaki">wait</span>`)
+	ev.Exec(command.Set("status_message", `<span foreground="khaki">wait</span>`))
 	return nil
 }
 
 func (p *Bar) evLoadCommit(ev *uzbl.Event) error {
 	p.updates = 0
-	ev.Uzbl.Send(`set status_message <span foreground="green">recv</span>`)
+	ev.Exec(command.Set("status_message", `<span foreground="green">recv</span>`))
 	return nil
 }
 
 func (p *Bar) evLoadProgress(ev *uzbl.Event) error {
 	p.updates++
-	progress := 100
-	var err error
-	if ev.Detail != "" {
-		progress, err = strconv.Atoi(ev.ParseDetail(1)[0])
-		if err != nil {
-			return err
-		}
+	lp, err := events.DecodeLoadProgress(ev.Event)
+	if err != nil {
+		return err
 	}
+	progress := lp.Percent
 
 	format := ev.Uzbl.Variables.GetString("progress.format", "[%d>%p]%c")
 	swidth := ev.Uzbl.Variables.GetString("progress.width", "8")
@@ -64,16 +66,10 @@ func (p *Bar) evLoadProgress(ev *uzbl.Event) error {
 		index = p.updates % len(spinner)
 	}
 	spinner = string(spinner[index])
-	if spinner == `\` {
-		spinner = `\\`
-	}
 
 	sprites := ev.Uzbl.Variables.GetString("progress.sprites", "loading")
 	index = int(((float64(progress)/100.0)*float64(len(sprites)))+0.5) - 1
 	sprite := string(sprites[index])
-	if sprite == `\` {
-		sprite = `\\`
-	}
 
 	count := strings.Count(format, "%c") + strings.Count(format, "%i")
 	width += (3 - len(strconv.Itoa(progress))) * count
@@ -120,6 +116,6 @@ func (p *Bar) evLoadProgress(ev *uzbl.Event) error {
 		output += string(c)
 	}
 
-	ev.Uzbl.Send(fmt.Sprintf("set progress.output %s", output))
+	ev.Exec(command.Set("progress.output", output))
 	return nil
 }
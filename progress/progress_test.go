@@ -0,0 +1,34 @@
+package progress_test
+
+import (
+	"testing"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/progress"
+	"honnef.co/go/uzbl/uzbltest"
+)
+
+func TestBar(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{}, &progress.Bar{})
+	f.Emit("LOAD_START", "'http://example.com/'")
+	if got, want := f.Var("status_message"), `<span foreground="khaki">wait</span>`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	f.Emit("LOAD_PROGRESS", "50")
+	if got, want := f.Var("progress.output"), "[=====>    ]50%"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	f.Emit("LOAD_PROGRESS", "100")
+	if got, want := f.Var("progress.output"), "[========>]100%"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	f.Uzbl.Exec(command.Set("progress.format", "%i/%o"))
+	f.Sync()
+	f.Emit("LOAD_PROGRESS", "30")
+	if got, want := f.Var("progress.output"), "30/70"; got != want {
+		t.Errorf("custom format: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,109 @@
+package uzbl
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/event_manager"
+)
+
+// Query asks uzbl-core to expand expr and returns the result. expr
+// may use any of uzbl's expansions, for example @uri or
+// @<document.title>@.
+//
+// Replies are delivered independently of regular event handlers, so
+// Query may be called from within a handler.
+func (u *Uzbl) Query(ctx context.Context, expr string) (string, error) {
+	if u.writer() == nil {
+		return "", ErrNotStarted
+	}
+	u.mu.Lock()
+	u.queryID++
+	cookie := strconv.FormatUint(u.queryID, 10)
+	ch := make(chan string, 1)
+	u.queries[cookie] = ch
+	u.mu.Unlock()
+
+	defer func() {
+		u.mu.Lock()
+		delete(u.queries, cookie)
+		u.mu.Unlock()
+	}()
+
+	if err := u.Exec(command.RawEvent("QUERY_REPLY", cookie+" "+expr)); err != nil {
+		return "", err
+	}
+	select {
+	case s := <-ch:
+		return s, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (u *Uzbl) evQueryReply(ev *event_manager.Event) error {
+	cookie, value := ev.Detail, ""
+	if idx := strings.Index(ev.Detail, " "); idx >= 0 {
+		cookie, value = ev.Detail[:idx], ev.Detail[idx+1:]
+	}
+
+	u.mu.Lock()
+	ch, ok := u.queries[cookie]
+	u.mu.Unlock()
+	if !ok {
+		// reply to a query that timed out or belongs to another
+		// event manager
+		return nil
+	}
+	select {
+	case ch <- value:
+	default:
+	}
+	return nil
+}
+
+// JSError is a JavaScript exception raised by a script run with
+// EvalJS.
+type JSError struct {
+	Message string
+}
+
+func (e JSError) Error() string {
+	return "JavaScript error: " + e.Message
+}
+
+// EvalJS evaluates script in the page and returns the string
+// representation of its result. Exceptions are returned as JSError.
+func (u *Uzbl) EvalJS(ctx context.Context, script string) (string, error) {
+	// The result is URI-encoded so that newlines can't break the
+	// event line.
+	expr := fmt.Sprintf(`@<(function() { `+
+		`try { return "ok " + encodeURIComponent(String(eval(%s))); } `+
+		`catch (e) { return "err " + encodeURIComponent(String(e)); } `+
+		`})()>@`, command.JSString(script))
+
+	res, err := u.Query(ctx, expr)
+	if err != nil {
+		return "", err
+	}
+	status, value := res, ""
+	if idx := strings.Index(res, " "); idx >= 0 {
+		status, value = res[:idx], res[idx+1:]
+	}
+	value, err = url.PathUnescape(value)
+	if err != nil {
+		return "", err
+	}
+	switch status {
+	case "ok":
+		return value, nil
+	case "err":
+		return "", JSError{value}
+	default:
+		return "", fmt.Errorf("unexpected reply to EvalJS: %q", res)
+	}
+}
@@ -0,0 +1,41 @@
+package uzbl_test
+
+import (
+	"context"
+	"testing"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/uzbltest"
+)
+
+func TestQueryNotStarted(t *testing.T) {
+	u := uzbl.New(uzbl.Options{})
+	if _, err := u.Query(context.Background(), "@uri"); err != uzbl.ErrNotStarted {
+		t.Errorf("got %v, want %v", err, uzbl.ErrNotStarted)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{})
+	f.JS = func(expr string) string { return "<" + expr + ">" }
+	res, err := f.Uzbl.Query(context.Background(), "@<document.title>@ done")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "<document.title> done"; res != want {
+		t.Errorf("got %q, want %q", res, want)
+	}
+}
+
+func TestEvalJSEscapes(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{})
+	f.EvalJS = func(script string) (string, error) { return script, nil }
+	script := `"a>@b" + '<c>' + "\n"`
+	res, err := f.Uzbl.EvalJS(context.Background(), script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != script {
+		t.Errorf("got %q, want %q", res, script)
+	}
+}
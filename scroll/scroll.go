@@ -2,23 +2,28 @@ package scroll // import "honnef.co/go/uzbl/scroll"
 
 import (
 	"fmt"
-	"strconv"
 
 	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/event_manager/events"
 )
 
 type Indicator struct{}
 
+func (s *Indicator) Name() string {
+	return "scroll"
+}
+
 func (s *Indicator) Init(u *uzbl.Uzbl) {
 	u.AddHandler("SCROLL_VERT", s.evScrollVert)
 }
 
 func (s *Indicator) evScrollVert(ev *uzbl.Event) error {
-	numbers, err := parseFloats(ev.ParseDetail(4)...)
+	sc, err := events.DecodeScroll(ev.Event)
 	if err != nil {
 		return err
 	}
-	cur, _, max, size := numbers[0], numbers[1], numbers[2], numbers[3]
+	cur, max, size := sc.Value, sc.Max, sc.Page
 	out := "--"
 
 	if max == 0 {
@@ -34,18 +39,6 @@ func (s *Indicator) evScrollVert(ev *uzbl.Event) error {
 		out = fmt.Sprintf("%.2f%%", float64(int((10000*p)+0.5))/100)
 	}
 
-	ev.Uzbl.Send(fmt.Sprintf("set scroll_message %s", out))
+	ev.Exec(command.Set("scroll_message", out))
 	return nil
 }
-
-func parseFloats(ss ...string) ([]float64, error) {
-	out := make([]float64, len(ss))
-	var err error
-	for i, s := range ss {
-		out[i], err = strconv.ParseFloat(s, 64)
-		if err != nil {
-			return out, err
-		}
-	}
-	return out, nil
-}
@@ -0,0 +1,28 @@
+package scroll_test
+
+import (
+	"testing"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/scroll"
+	"honnef.co/go/uzbl/uzbltest"
+)
+
+func TestIndicator(t *testing.T) {
+	tests := []struct {
+		detail string
+		want   string
+	}{
+		{"0 0 0 0", "All"},
+		{"0 0 1000 100", "Top"},
+		{"900 0 1000 100", "Bot"},
+		{"450 0 1000 100", "50.00%"},
+	}
+	f := uzbltest.New(t, uzbl.Options{}, &scroll.Indicator{})
+	for _, tt := range tests {
+		f.Emit("SCROLL_VERT", tt.detail)
+		if got := f.Var("scroll_message"); got != tt.want {
+			t.Errorf("SCROLL_VERT %s: got %q, want %q", tt.detail, got, tt.want)
+		}
+	}
+}
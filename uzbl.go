@@ -1,20 +1,27 @@
 package uzbl // import "honnef.co/go/uzbl"
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"os/exec"
 	"regexp"
-	"strconv"
-	"strings"
+	"sync"
+	"time"
 
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/config"
 	"honnef.co/go/uzbl/event_manager"
+	"honnef.co/go/uzbl/event_manager/events"
 )
 
 type Event struct {
 	*event_manager.Event
 	Uzbl *Uzbl
+	// source is the plugin that registered the handler
+	source string
 }
 
 type Handler func(*Event) error
@@ -34,14 +41,85 @@ type Registerable interface {
 	Init(*Uzbl)
 }
 
+// Closer is implemented by plugins that need to clean up when Uzbl
+// shuts down. Close is called once no more events are handled and
+// the connection to uzbl-core has been closed, so it can't send
+// commands.
+type Closer interface {
+	Close() error
+}
+
+// ShutdownTimeout is how long Run waits for uzbl-core to exit after
+// its context has been cancelled, before killing it.
+var ShutdownTimeout = 5 * time.Second
+
+// Options configure how uzbl-core is launched.
+type Options struct {
+	// Binary is the uzbl-core executable. It defaults to "uzbl-core".
+	Binary string
+	// URI is the page to load on start. It is not passed to uzbl-core
+	// if empty.
+	URI string
+	// Args are additional arguments passed to uzbl-core.
+	Args []string
+	// Env is the environment of the uzbl-core process. If nil, the
+	// current process's environment is used.
+	Env []string
+	// Dir is the working directory of the uzbl-core process.
+	Dir string
+	// Stderr receives uzbl-core's standard error. It defaults to
+	// os.Stderr.
+	Stderr io.Writer
+	// Config is the path of the config file. If empty, uzbl/config
+	// is looked up in $XDG_CONFIG_HOME and $XDG_CONFIG_DIRS.
+	Config string
+	// OnCommandError is called for every error uzbl-core reports for
+	// a command. If nil, errors are logged.
+	OnCommandError func(*CommandError)
+	// Restart enables restarting uzbl-core when it exits abnormally.
+	Restart bool
+	// Conn, if set, is a connection to an already running instance
+	// of uzbl-core, which is used instead of launching a new one.
+	// See DialSocket and OpenFIFO.
+	Conn io.ReadWriteCloser
+	// Middleware wraps all event handlers.
+	Middleware []event_manager.Middleware
+	// Trace, if set, receives a trace of all events, which can be
+	// replayed with event_manager.Manager.Replay.
+	Trace io.Writer
+}
+
 type Uzbl struct {
-	stdin      io.WriteCloser
-	stdout     io.ReadCloser
+	opts       Options
+	w          *writer
 	Variables  *VariableStore
 	geometry   geom
 	em         *event_manager.Manager
 	IM         *InputManager
 	registered []Registerable
+	// plugins are the registered plugins in initialization order
+	plugins       []Registerable
+	pluginsClosed bool
+
+	mu       sync.Mutex
+	queryID  uint64
+	queries  map[string]chan string
+	pending  []pendingCommand
+	disabled map[string]bool
+	// source is the plugin currently being initialized
+	source string
+	// registrations are the handlers registered by each plugin
+	// during Init, removed when the plugin is reloaded
+	registrations map[string][]*event_manager.Registration
+	// onEvent are the handlers registered with @on_event
+	onEvent []*event_manager.Registration
+	uri     string
+	// manager is the Manager this instance belongs to, if any
+	manager *Manager
+}
+
+func New(opts Options) *Uzbl {
+	return &Uzbl{opts: opts}
 }
 
 func (u *Uzbl) Register(r ...Registerable) {
@@ -73,110 +151,423 @@ func parseString(s string) (string, error) {
 	return s[1 : len(s)-1], nil
 }
 
-func parseInts(ss ...string) ([]int, error) {
-	out := make([]int, len(ss))
-	var err error
-	for i, s := range ss {
-		out[i], err = strconv.Atoi(s)
-		if err != nil {
-			return out, err
-		}
-	}
-	return out, nil
+// AddHandler registers fn for the event ev, which may be a pattern
+// as described in event_manager.Manager.AddHandler. Handlers
+// registered by a plugin during Init aren't called while the plugin
+// is disabled. The returned registration can be used to remove the
+// handler again.
+func (u *Uzbl) AddHandler(ev string, fn Handler) *event_manager.Registration {
+	return u.track(u.em.AddHandler(ev, u.wrap(fn)))
 }
 
-func (u *Uzbl) AddHandler(ev string, fn Handler) {
-	u.em.AddHandler(ev, func(event *event_manager.Event) error {
-		return fn(&Event{event, u})
-	})
+// Events returns a source for the typed subscriptions in package
+// events. Handlers registered through it are subject to the same
+// rules as those registered with AddHandler.
+func (u *Uzbl) Events() events.Source {
+	return eventSource{u}
+}
+
+type eventSource struct {
+	u *Uzbl
+}
+
+func (s eventSource) AddHandler(ev string, fn event_manager.Handler) *event_manager.Registration {
+	return s.u.AddHandler(ev, func(ev *Event) error { return fn(ev.Event) })
+}
+
+// AddHandlerPriority is like AddHandler, but with a priority as
+// described in event_manager.Manager.AddHandlerPriority.
+func (u *Uzbl) AddHandlerPriority(ev string, priority int, fn Handler) *event_manager.Registration {
+	return u.track(u.em.AddHandlerPriority(ev, priority, u.wrap(fn)))
+}
+
+// Once is like AddHandler, but fn is only called for the first
+// matching event.
+func (u *Uzbl) Once(ev string, fn Handler) *event_manager.Registration {
+	return u.track(u.em.Once(ev, u.wrap(fn)))
+}
+
+// WaitFor waits for the next matching event, as described in
+// event_manager.Manager.WaitFor. It may be called from within
+// handlers.
+func (u *Uzbl) WaitFor(ctx context.Context, ev string, pred func(*event_manager.Event) bool) (*event_manager.Event, error) {
+	return u.em.WaitFor(ctx, ev, pred)
+}
+
+// AddPredicateHandler is like AddHandler, but fn is only called for
+// events for which pred returns true.
+func (u *Uzbl) AddPredicateHandler(ev string, pred func(*event_manager.Event) bool, fn Handler) *event_manager.Registration {
+	return u.track(u.em.AddPredicateHandler(ev, pred, u.wrap(fn)))
+}
+
+func (u *Uzbl) wrap(fn Handler) event_manager.Handler {
+	u.mu.Lock()
+	source := u.source
+	u.mu.Unlock()
+	return func(event *event_manager.Event) error {
+		if source != "" && !u.PluginEnabled(source) {
+			return nil
+		}
+		return fn(&Event{event, u, source})
+	}
 }
 
 func (u *Uzbl) evOnEvent(ev *Event) error {
 	parts := ev.ParseDetail(2)
 	evName, payload := parts[0], parts[1]
-	u.AddHandler(evName, func(*Event) error {
-		u.Send(payload)
+	reg := u.AddHandler(evName, func(*Event) error {
+		u.send("@on_event "+evName, payload)
 		return nil
 	})
+	u.mu.Lock()
+	u.onEvent = append(u.onEvent, reg)
+	u.mu.Unlock()
 	return nil
 }
 
 func (u *Uzbl) evGeometryChanged(ev *Event) error {
-	s, err := parseString(ev.Detail)
+	g, err := events.DecodeGeometry(ev.Event)
 	if err != nil {
 		return err
 	}
-	parts := strings.Split(s, "+")
-	dim := strings.Split(parts[0], "x")
-	x := parts[1]
-	y := parts[2]
-	width := dim[0]
-	height := dim[1]
+	u.geometry.X, u.geometry.Y, u.geometry.Width, u.geometry.Height =
+		g.X, g.Y, g.Width, g.Height
+	return nil
+}
 
-	ints, err := parseInts(x, y, width, height)
+func (u *Uzbl) loadConfig() error {
+	path, err := u.configPath()
 	if err != nil {
 		return err
 	}
-	u.geometry.X, u.geometry.Y, u.geometry.Width, u.geometry.Height =
-		ints[0], ints[1], ints[2], ints[3]
-
+	f, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	for _, err := range f.Errors {
+		log.Println(err)
+	}
+	for _, cmd := range f.Commands() {
+		if err := u.Send(cmd); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (u *Uzbl) loadConfig() error {
-	fmt.Println("Loading config")
-	// TODO XDG
-	f, err := os.Open("/home/dominikh/.config/uzbl/config")
-	if err != nil {
+func (u *Uzbl) command(uri string) *exec.Cmd {
+	args := []string{"-c", "-", "-p"}
+	if uri != "" {
+		args = append(args, "--uri", uri)
+	}
+	args = append(args, u.opts.Args...)
+	bin := u.opts.Binary
+	if bin == "" {
+		bin = "uzbl-core"
+	}
+	cmd := exec.Command(bin, args...)
+	cmd.Env = u.opts.Env
+	cmd.Dir = u.opts.Dir
+	cmd.Stderr = u.opts.Stderr
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	return cmd
+}
+
+// Start runs uzbl-core until it exits. It is equivalent to
+// Run(context.Background()).
+func (u *Uzbl) Start() error {
+	return u.Run(context.Background())
+}
+
+// Run launches uzbl-core, loads the configuration and handles events
+// until uzbl-core exits or ctx is cancelled. In either case, plugins
+// implementing Closer are closed in reverse order of initialization,
+// after all events have been handled.
+// On cancellation, uzbl-core is asked to exit and killed if it
+// doesn't do so within ShutdownTimeout.
+//
+// If Options.Restart is set and uzbl-core exits abnormally, it is
+// restarted with the last committed URI and the config is replayed.
+// Plugins are kept across restarts.
+//
+// If Options.Conn is set, Run attaches to an existing uzbl-core
+// instead and returns once the connection is closed. Variables are
+// picked up from the running instance, but binds and on_event
+// handlers defined before attaching are not.
+//
+// Run returns ctx.Err() if ctx was cancelled and uzbl-core's exit
+// error otherwise.
+func (u *Uzbl) Run(ctx context.Context) error {
+	if err := u.init(); err != nil {
 		return err
 	}
-	defer f.Close()
-	_, err = io.Copy(u.stdin, f) // TODO turn this into channel+sendCommands
-	return err
+	// runOnce and runAttached only return once all handlers have
+	// returned, so plugins aren't closed while they're in use.
+	defer u.closePlugins()
+
+	if u.opts.Conn != nil {
+		return u.runAttached(ctx)
+	}
+
+	uri := u.opts.URI
+	for {
+		started := time.Now()
+		exited, err := u.runOnce(ctx, uri)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !exited || err == nil || !u.opts.Restart {
+			return err
+		}
+
+		log.Printf("uzbl-core exited abnormally (%s), restarting", err)
+		if d := time.Since(started); d < restartDelay {
+			select {
+			case <-time.After(restartDelay - d):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if last := u.URI(); last != "" {
+			uri = last
+		}
+		u.reset()
+	}
 }
 
-func (u *Uzbl) Start() {
-	cmd := exec.Command("uzbl-core", "-c", "-", "-p", "--uri", "https://google.com")
+// restartDelay is the minimum time between restarts of uzbl-core, to
+// avoid spinning if it crashes immediately.
+const restartDelay = time.Second
+
+// runOnce runs a single uzbl-core process. exited reports whether
+// uzbl-core ran and exited on its own, in which case err is the
+// error returned by waiting for it.
+func (u *Uzbl) runOnce(ctx context.Context, uri string) (exited bool, err error) {
+	cmd := u.command(uri)
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		panic(err)
+		return false, err
+	}
+
+	w := newWriter(stdin)
+	u.mu.Lock()
+	u.w = w
+	u.mu.Unlock()
+	defer w.close()
+
+	err = cmd.Start()
+	if err != nil {
+		return false, fmt.Errorf("could not start uzbl-core: %s", err)
+	}
+	listening := make(chan struct{})
+	go func() {
+		u.em.Serve(stdout)
+		close(listening)
+	}()
+
+	if err := u.loadConfig(); err != nil {
+		cmd.Process.Kill()
+		<-listening
+		cmd.Wait()
+		return false, fmt.Errorf("could not load config: %s", err)
+	}
+	reg := u.configureWhenLoaded()
+	defer reg.Remove()
+
+	select {
+	case <-listening:
+		w.close()
+		return true, cmd.Wait()
+	case <-ctx.Done():
+	}
+
+	// The kill timer has to run while flushing the remaining
+	// commands, as a hung uzbl-core might not read them at all.
+	kill := time.AfterFunc(ShutdownTimeout, func() { cmd.Process.Kill() })
+	defer kill.Stop()
+	u.Exec(command.Exit())
+	w.close()
+	<-listening
+	cmd.Wait()
+	return false, ctx.Err()
+}
+
+// reset discards state that is rebuilt by replaying the config.
+func (u *Uzbl) reset() {
+	u.mu.Lock()
+	u.pending = nil
+	onEvent := u.onEvent
+	u.onEvent = nil
+	u.mu.Unlock()
+	for _, reg := range onEvent {
+		reg.Remove()
+	}
+	u.IM.reset()
+}
+
+// URI returns the URI of the last committed page load.
+func (u *Uzbl) URI() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.uri
+}
+
+func (u *Uzbl) evLoadCommit(ev *Event) error {
+	l, err := events.DecodeLoad(ev.Event)
+	if err != nil {
+		return err
 	}
-	cmd.Stderr = os.Stderr
+	u.mu.Lock()
+	u.uri = l.URI
+	u.mu.Unlock()
+	return nil
+}
 
-	u.stdin = stdin
-	u.stdout = stdout
+func (u *Uzbl) init() error {
+	plugins, err := resolvePlugins(u.registered)
+	if err != nil {
+		return err
+	}
+	u.plugins = plugins
 
-	u.em = event_manager.New(stdout)
+	u.em = event_manager.New(nil)
+	u.em.Use(u.opts.Middleware...)
+	if u.opts.Trace != nil {
+		u.em.Record(u.opts.Trace)
+	}
+	u.queries = make(map[string]chan string)
+	u.disabled = make(map[string]bool)
+	u.registrations = make(map[string][]*event_manager.Registration)
+	u.em.AddImmediateHandler("QUERY_REPLY", u.evQueryReply)
+	u.em.AddHandler("COMMAND_EXECUTED", u.evCommandExecuted)
+	u.em.AddHandler("COMMAND_ERROR", u.evCommandError)
 	u.Variables = NewVariableStore()
 	u.IM = NewInputManager(u)
 	u.AddHandler("VARIABLE_SET", u.Variables.evVariableSet)
 	u.AddHandler("GEOMETRY_CHANGED", u.evGeometryChanged)
 	u.AddHandler("ON_EVENT", u.evOnEvent)
+	u.AddHandler("LOAD_COMMIT", u.evLoadCommit)
+	u.AddHandler("PLUGIN_ENABLE", u.evPluginEnable)
+	u.AddHandler("PLUGIN_DISABLE", u.evPluginDisable)
+	u.AddHandler("PLUGIN_RELOAD", u.evPluginReload)
+	u.AddHandler("PLUGIN_LIST", u.evPluginList)
+	u.AddHandler("BROADCAST", u.evBroadcast)
+	u.AddHandler("UNICAST", u.evUnicast)
 
-	// FIXME it's really ugly that the order of this matters
+	for _, p := range u.plugins {
+		u.initPlugin(p)
+	}
+	return u.checkEventDependencies()
+}
+
+// configuredEvent is emitted through uzbl-core after the config has
+// been sent, to find out when it has been processed.
+const configuredEvent = "EM_CONFIGURED"
 
-	for _, r := range u.registered {
-		r.Init(u)
+// configureWhenLoaded configures the plugins once uzbl-core has
+// processed all commands sent so far and the events they caused
+// have been handled, for example the VARIABLE_SET events of the
+// config. Configure runs on the goroutine of the regular handlers,
+// so it doesn't race with them.
+func (u *Uzbl) configureWhenLoaded() *event_manager.Registration {
+	reg := u.em.Once(configuredEvent, func(*event_manager.Event) error {
+		u.configurePlugins()
+		return nil
+	})
+	u.Exec(command.Event(configuredEvent))
+	return reg
+}
+
+// configurePlugins configures all plugins implementing Configurable,
+// in order of initialization. It has to be called after the config
+// has been processed, see configureWhenLoaded.
+func (u *Uzbl) configurePlugins() {
+	for _, p := range u.plugins {
+		c, ok := p.(Configurable)
+		if !ok {
+			continue
+		}
+		if err := c.Configure(u); err != nil {
+			log.Printf("error configuring %s: %s", PluginName(p), err)
+		}
 	}
+}
 
-	go u.em.Listen()
-	err = cmd.Start()
-	if err != nil {
-		panic(err)
+// closePlugins closes all plugins implementing Closer, in reverse
+// order of initialization. Plugins are only closed once.
+func (u *Uzbl) closePlugins() {
+	if u.pluginsClosed {
+		return
 	}
+	u.pluginsClosed = true
+	for i := len(u.plugins) - 1; i >= 0; i-- {
+		c, ok := u.plugins[i].(Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			log.Printf("error closing %s: %s", PluginName(u.plugins[i]), err)
+		}
+	}
+}
 
-	u.loadConfig()
+// Send queues cmd to be sent to uzbl-core. Commands are written in
+// order, and Send blocks if too many commands are queued. It returns
+// an error if cmd is invalid or if writing to uzbl-core has failed,
+// in which case all further commands fail as well.
+func (u *Uzbl) Send(cmd string) error {
+	return u.send("", cmd)
+}
 
-	cmd.Wait()
+func (u *Uzbl) send(source, cmd string) error {
+	w := u.writer()
+	if w == nil {
+		return ErrNotStarted
+	}
+	// The command has to be pending before it is sent, or uzbl-core
+	// might report on it before it has been added.
+	p := u.addPending(source, cmd)
+	if err := w.send(cmd); err != nil {
+		u.removePending(p)
+		return err
+	}
+	return nil
+}
+
+// Exec sends each of cmds to uzbl-core. It stops at the first error.
+func (u *Uzbl) Exec(cmds ...command.Command) error {
+	return u.exec("", cmds)
+}
+
+func (u *Uzbl) exec(source string, cmds []command.Command) error {
+	for _, cmd := range cmds {
+		if err := u.send(source, cmd.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Err returns the error that caused writing to uzbl-core to fail,
+// if any.
+func (u *Uzbl) Err() error {
+	w := u.writer()
+	if w == nil {
+		return nil
+	}
+	return w.Err()
 }
 
-func (u *Uzbl) Send(cmd string) {
-	u.stdin.Write([]byte(cmd))
-	u.stdin.Write([]byte{'\n'})
+func (u *Uzbl) writer() *writer {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.w
 }
 
 func (u *Uzbl) CommandFn(cmd string) func(*Event, Keys) error {
@@ -185,7 +576,7 @@ func (u *Uzbl) CommandFn(cmd string) func(*Event, Keys) error {
 		if ok, _ := regexp.MatchString("[^%]%s", cmd); ok {
 			cmd = fmt.Sprintf(cmd, input.String())
 		}
-		u.Send(cmd)
+		u.send("@bind", cmd)
 		return nil
 	}
 }
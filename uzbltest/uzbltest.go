@@ -0,0 +1,375 @@
+// Package uzbltest provides a fake uzbl-core for testing plugins
+// without X or WebKit.
+//
+// A test creates a Fake with the plugins under test, emits the
+// events uzbl-core would emit and checks the commands sent in
+// response:
+//
+//	func TestTop(t *testing.T) {
+//		f := uzbltest.New(t, uzbl.Options{}, &scroll.Indicator{})
+//		f.Emit("SCROLL_VERT", "0 0 1000 100")
+//		f.ExpectCommand("set scroll_message Top")
+//	}
+package uzbltest // import "honnef.co/go/uzbl/uzbltest"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/event_manager"
+)
+
+// PID is the process ID used in emitted events.
+const PID = 1
+
+// DefaultTimeout is how long Emit and ExpectCommand wait by default.
+var DefaultTimeout = time.Second
+
+// Sync emits syncEvent, whose handler sends an event command for
+// syncedEvent. Once that has been handled, all commands sent for
+// earlier events have been received and the events they caused have
+// been handled.
+const (
+	syncEvent   = "UZBLTEST_SYNC"
+	syncedEvent = "UZBLTEST_SYNCED"
+)
+
+// Fake is an in-memory uzbl-core driving a Uzbl.
+//
+// Like uzbl-core, it turns event commands back into events and emits
+// VARIABLE_SET for set commands and, for all variables, for
+// dump_config_as_events. Expansions in event commands are
+// performed using the variables that have been set and EvalJS.
+type Fake struct {
+	Uzbl *uzbl.Uzbl
+	// Timeout is how long Emit and ExpectCommand wait.
+	Timeout time.Duration
+	// EvalJS, if set, evaluates scripts passed to Uzbl.EvalJS. If
+	// nil, EvalJS fails.
+	EvalJS func(script string) (string, error)
+	// JS, if set, evaluates other @<...>@ expansions. If nil, they
+	// expand to the empty string.
+	JS func(expr string) string
+
+	t      testing.TB
+	pr     *io.PipeReader
+	pw     *io.PipeWriter
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	buf      bytes.Buffer
+	commands []string
+	next     int
+	vars     map[string]string
+	syncID   int
+	synced   map[string]chan struct{}
+}
+
+// New starts a Uzbl with opts and plugins, connected to a new Fake.
+// opts.Conn is overwritten. The Fake is shut down when the test
+// finishes.
+func New(t testing.TB, opts uzbl.Options, plugins ...uzbl.Registerable) *Fake {
+	t.Helper()
+	f := &Fake{
+		Timeout: DefaultTimeout,
+		t:       t,
+		done:    make(chan struct{}),
+		vars:    make(map[string]string),
+		synced:  make(map[string]chan struct{}),
+	}
+	f.cond = sync.NewCond(&f.mu)
+	f.pr, f.pw = io.Pipe()
+	opts.Conn = conn{f}
+	f.Uzbl = uzbl.New(opts)
+	f.Uzbl.Register(plugins...)
+	f.Uzbl.Register(syncPlugin{f})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	go func() {
+		err := f.Uzbl.Run(ctx)
+		if err != nil && err != context.Canceled {
+			f.err = err
+		}
+		close(f.done)
+	}()
+	t.Cleanup(f.Close)
+	f.Sync()
+	return f
+}
+
+// Close stops the Uzbl. It is called automatically at the end of
+// the test.
+func (f *Fake) Close() {
+	f.cancel()
+	<-f.done
+}
+
+// Emit emits the event name with the given detail and waits until
+// all handlers have run.
+func (f *Fake) Emit(name, detail string) {
+	f.t.Helper()
+	f.EmitLine(fmt.Sprintf("EVENT [%d] %s %s", PID, name, detail))
+	f.Sync()
+}
+
+// EmitLine writes a raw line to the Uzbl without waiting for it to
+// be handled, for example a REQUEST-<cookie> line.
+func (f *Fake) EmitLine(line string) {
+	f.t.Helper()
+	if _, err := io.WriteString(f.pw, line+"\n"); err != nil {
+		f.t.Fatalf("uzbltest: emitting event: %s", err)
+	}
+}
+
+// Replay emits the events of a trace recorded with Options.Trace or
+// event_manager.Manager.Record and waits until all handlers have run.
+// Unlike event_manager.Manager.Replay, the events reach the Uzbl's
+// input manager and plugins, and commands sent in response are
+// simulated and recorded like for Emit.
+func (f *Fake) Replay(ctx context.Context, r io.Reader, speed float64) error {
+	f.t.Helper()
+	if err := event_manager.ReplayTo(ctx, r, f.pw, speed); err != nil {
+		return err
+	}
+	f.Sync()
+	return nil
+}
+
+// Sync waits until all events emitted so far have been handled and
+// all commands sent by their handlers have been received.
+func (f *Fake) Sync() {
+	f.t.Helper()
+	f.mu.Lock()
+	f.syncID++
+	id := strconv.Itoa(f.syncID)
+	ch := make(chan struct{})
+	f.synced[id] = ch
+	f.mu.Unlock()
+
+	f.EmitLine(fmt.Sprintf("EVENT [%d] %s %s", PID, syncEvent, id))
+	select {
+	case <-ch:
+	case <-f.done:
+		f.t.Fatalf("uzbltest: uzbl stopped: %v", f.err)
+	case <-time.After(f.Timeout):
+		f.t.Fatalf("uzbltest: timed out waiting for handlers")
+	}
+}
+
+// Commands returns all commands received so far.
+func (f *Fake) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+// ExpectCommand waits for cmd to be sent. Commands are matched in
+// order: each call only considers commands sent after the one
+// matched by the previous call.
+func (f *Fake) ExpectCommand(cmd string) {
+	f.t.Helper()
+	deadline := time.Now().Add(f.Timeout)
+	timer := time.AfterFunc(f.Timeout, func() {
+		f.mu.Lock()
+		f.cond.Broadcast()
+		f.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		for i := f.next; i < len(f.commands); i++ {
+			if f.commands[i] == cmd {
+				f.next = i + 1
+				return
+			}
+		}
+		if !time.Now().Before(deadline) {
+			f.t.Fatalf("uzbltest: expected command %q, got %q", cmd, f.commands[f.next:])
+		}
+		f.cond.Wait()
+	}
+}
+
+// Var returns the value of a variable set by a command.
+func (f *Fake) Var(name string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.vars[name]
+}
+
+// write receives commands from the Uzbl.
+func (f *Fake) write(p []byte) (int, error) {
+	f.mu.Lock()
+	f.buf.Write(p)
+	var lines []string
+	for {
+		line, err := f.buf.ReadString('\n')
+		if err != nil {
+			// incomplete line, keep it for the next write
+			f.buf.Reset()
+			f.buf.WriteString(line)
+			break
+		}
+		line = strings.TrimSuffix(line, "\n")
+		lines = append(lines, line)
+		if !strings.HasPrefix(line, "event "+syncedEvent+" ") {
+			f.commands = append(f.commands, line)
+		}
+	}
+	f.mu.Unlock()
+	f.cond.Broadcast()
+
+	for _, line := range lines {
+		if err := f.simulate(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func cut(s string) (string, string) {
+	idx := strings.IndexAny(s, " \t")
+	if idx < 0 {
+		return s, ""
+	}
+	return s[:idx], strings.TrimLeft(s[idx:], " \t")
+}
+
+func (f *Fake) simulate(line string) error {
+	name, rest := cut(line)
+	var out string
+	switch name {
+	case "set":
+		name, value := cut(rest)
+		args, _ := command.SplitLiteral(value)
+		value = strings.Join(args, " ")
+		f.mu.Lock()
+		f.vars[name] = value
+		f.mu.Unlock()
+		out = fmt.Sprintf("VARIABLE_SET %s str '%s'", name, strEscaper.Replace(value))
+	case "dump_config_as_events":
+		f.mu.Lock()
+		names := make([]string, 0, len(f.vars))
+		for name := range f.vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var b strings.Builder
+		for _, name := range names {
+			fmt.Fprintf(&b, "EVENT [%d] VARIABLE_SET %s str '%s'\n", PID, name, strEscaper.Replace(f.vars[name]))
+		}
+		f.mu.Unlock()
+		_, err := io.WriteString(f.pw, b.String())
+		return err
+	case "event":
+		out = f.expand(rest)
+		if !strings.Contains(out, " ") {
+			// events without a detail still need the separator
+			out += " "
+		}
+	default:
+		return nil
+	}
+	_, err := io.WriteString(f.pw, fmt.Sprintf("EVENT [%d] %s\n", PID, out))
+	return err
+}
+
+// strEscaper escapes strings in event details like uzbl-core.
+var strEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// reEvalJS matches the script in expressions built by Uzbl.EvalJS.
+var reEvalJS = regexp.MustCompile(`eval\(("(?:[^"\\]|\\.)*")\)`)
+
+func (f *Fake) expand(s string) string {
+	return command.Expand(s, func(e command.Expansion) string {
+		switch e.Kind {
+		case command.ExpandVar:
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			return f.vars[e.Expr]
+		case command.ExpandJS:
+			if m := reEvalJS.FindStringSubmatch(e.Expr); m != nil {
+				var script string
+				if err := json.Unmarshal([]byte(m[1]), &script); err == nil {
+					return f.evalJS(script)
+				}
+			}
+			if f.JS != nil {
+				return f.JS(e.Expr)
+			}
+		}
+		return ""
+	})
+}
+
+func (f *Fake) evalJS(script string) string {
+	var res string
+	err := errors.New("uzbltest: EvalJS not set")
+	if f.EvalJS != nil {
+		res, err = f.EvalJS(script)
+	}
+	if err != nil {
+		return "err " + url.PathEscape(err.Error())
+	}
+	return "ok " + url.PathEscape(res)
+}
+
+type conn struct {
+	f *Fake
+}
+
+func (c conn) Read(p []byte) (int, error)  { return c.f.pr.Read(p) }
+func (c conn) Write(p []byte) (int, error) { return c.f.write(p) }
+
+func (c conn) Close() error {
+	c.f.pw.Close()
+	return c.f.pr.Close()
+}
+
+// syncPlugin lets Sync find out when all previous events have been
+// handled.
+type syncPlugin struct {
+	f *Fake
+}
+
+func (p syncPlugin) Name() string {
+	return "uzbltest"
+}
+
+func (p syncPlugin) Init(u *uzbl.Uzbl) {
+	u.AddHandlerPriority(syncEvent, math.MaxInt32, func(ev *uzbl.Event) error {
+		ev.Exec(command.Event(syncedEvent, ev.Detail))
+		return event_manager.ErrStopPropagation
+	})
+	u.AddHandlerPriority(syncedEvent, math.MaxInt32, func(ev *uzbl.Event) error {
+		p.f.mu.Lock()
+		ch, ok := p.f.synced[ev.Detail]
+		delete(p.f.synced, ev.Detail)
+		p.f.mu.Unlock()
+		if ok {
+			close(ch)
+		}
+		return event_manager.ErrStopPropagation
+	})
+}
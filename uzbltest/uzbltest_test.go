@@ -0,0 +1,110 @@
+package uzbltest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"honnef.co/go/uzbl"
+	"honnef.co/go/uzbl/command"
+	"honnef.co/go/uzbl/scroll"
+	"honnef.co/go/uzbl/uzbltest"
+)
+
+// TestTop is the example from the package documentation.
+func TestTop(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{}, &scroll.Indicator{})
+	f.Emit("SCROLL_VERT", "0 0 1000 100")
+	f.ExpectCommand("set scroll_message Top")
+}
+
+func TestSetEmitsVariableSet(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{})
+	for _, value := range []string{"an example", `it's C:\`} {
+		f.Uzbl.Exec(command.Set("title", value))
+		f.Sync()
+		if got := f.Var("title"); got != value {
+			t.Errorf("Var = %q, want %q", got, value)
+		}
+		if got := f.Uzbl.Variables.GetString("title", ""); got != value {
+			t.Errorf("Variables = %q, want %q", got, value)
+		}
+	}
+}
+
+func TestAttachDumpsConfig(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{})
+	f.ExpectCommand("dump_config_as_events")
+}
+
+func TestEventExpansion(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{})
+	var got []string
+	f.Uzbl.AddHandler("ECHO", func(ev *uzbl.Event) error {
+		got = append(got, ev.Detail)
+		return nil
+	})
+	f.JS = func(expr string) string { return "js:" + expr }
+	f.Uzbl.Exec(command.Set("title", "Example"))
+	f.Uzbl.Exec(command.RawEvent("ECHO", "@title @<1+1>@ \\@title"))
+	f.Uzbl.Exec(command.Event("ECHO"))
+	f.Sync()
+
+	want := []string{"Example js:1+1 @title", ""}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestEvalJS(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{})
+	f.EvalJS = func(script string) (string, error) {
+		if script == "fail()" {
+			return "", errors.New("failed")
+		}
+		return "result of " + script, nil
+	}
+	res, err := f.Uzbl.EvalJS(ctx(t), "1 + 1")
+	if err != nil || res != "result of 1 + 1" {
+		t.Errorf("got (%q, %v), want (%q, nil)", res, err, "result of 1 + 1")
+	}
+	if _, err := f.Uzbl.EvalJS(ctx(t), "fail()"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestCommandsInOrder(t *testing.T) {
+	f := uzbltest.New(t, uzbl.Options{})
+	n := len(f.Commands())
+	f.Uzbl.Exec(command.Raw("one"), command.Raw("two"), command.Raw("three"))
+	f.ExpectCommand("one")
+	f.ExpectCommand("three")
+	f.Sync()
+
+	cmds := f.Commands()[n:]
+	if len(cmds) != 3 || cmds[0] != "one" || cmds[1] != "two" || cmds[2] != "three" {
+		t.Errorf("got %q, want [one two three]", cmds)
+	}
+}
+
+func ctx(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), uzbltest.DefaultTimeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestReplay(t *testing.T) {
+	var trace bytes.Buffer
+	f := uzbltest.New(t, uzbl.Options{Trace: &trace})
+	f.Emit("BIND", "x 'uri http://example.com/'")
+	f.Emit("KEY_PRESS", "'' x")
+	f.ExpectCommand("uri http://example.com/")
+	f.Close()
+
+	g := uzbltest.New(t, uzbl.Options{})
+	if err := g.Replay(ctx(t), &trace, 0); err != nil {
+		t.Fatal(err)
+	}
+	g.ExpectCommand("uri http://example.com/")
+}
@@ -2,7 +2,8 @@ package uzbl
 
 import (
 	"strconv"
-	"strings"
+
+	"honnef.co/go/uzbl/event_manager/events"
 )
 
 type VariableStore struct {
@@ -53,13 +54,11 @@ func (vs *VariableStore) GetString(name string, def string) string {
 }
 
 func (v *VariableStore) evVariableSet(ev *Event) error {
-	parts := strings.SplitN(ev.Detail, " ", 3)
-	name, typ, value := parts[0], parts[1], parts[2]
-	if value == `''` || len(value) < 2 {
-		value = ""
-	} else {
-		value = value[1 : len(value)-1]
+	set, err := events.DecodeVariableSet(ev.Event)
+	if err != nil {
+		return err
 	}
+	name, typ, value := set.Name, set.Type, set.Value
 	switch typ {
 	case "str":
 		v.SetString(name, value)
@@ -0,0 +1,144 @@
+package uzbl
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNotStarted = errors.New("uzbl: not started")
+	ErrClosed     = errors.New("uzbl: connection to uzbl-core closed")
+	ErrMultiline  = errors.New("uzbl: command must not contain newlines")
+)
+
+const (
+	// queueSize is the number of commands that can be queued before
+	// Send blocks.
+	queueSize = 256
+	// maxBatch is the maximum number of bytes written at once.
+	maxBatch = 64 * 1024
+)
+
+// writer serializes commands onto a single connection to uzbl-core.
+// Every command is written as a whole line, and commands that queue
+// up while a write is in progress are written together.
+type writer struct {
+	w     io.Writer
+	queue chan string
+	quit  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+
+	// mu is held while queueing a line, so that no line is queued
+	// once closed has been set and the queue is being drained.
+	mu     sync.Mutex
+	closed bool
+
+	errMu sync.Mutex
+	err   error
+}
+
+func newWriter(w io.Writer) *writer {
+	wr := &writer{
+		w:     w,
+		queue: make(chan string, queueSize),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go wr.loop()
+	return wr
+}
+
+func (w *writer) Err() error {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return w.err
+}
+
+func (w *writer) setErr(err error) {
+	w.errMu.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.errMu.Unlock()
+}
+
+func (w *writer) send(line string) error {
+	if strings.ContainsAny(line, "\r\n") {
+		return ErrMultiline
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	if err := w.Err(); err != nil {
+		return err
+	}
+	select {
+	case w.queue <- line:
+		return nil
+	case <-w.done:
+		return w.Err()
+	}
+}
+
+func (w *writer) loop() {
+	defer close(w.done)
+	var buf bytes.Buffer
+	for {
+		var line string
+		select {
+		case line = <-w.queue:
+		case <-w.quit:
+			// flush what has been queued so far
+			for {
+				select {
+				case line = <-w.queue:
+					buf.WriteString(line)
+					buf.WriteByte('\n')
+				default:
+					if buf.Len() > 0 {
+						w.w.Write(buf.Bytes())
+					}
+					w.setErr(ErrClosed)
+					return
+				}
+			}
+		}
+
+		buf.Reset()
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	batch:
+		for buf.Len() < maxBatch {
+			select {
+			case line = <-w.queue:
+				buf.WriteString(line)
+				buf.WriteByte('\n')
+			default:
+				break batch
+			}
+		}
+		if _, err := w.w.Write(buf.Bytes()); err != nil {
+			w.setErr(err)
+			return
+		}
+		buf.Reset()
+	}
+}
+
+// close flushes queued commands and stops the writer. Subsequent
+// sends fail with ErrClosed.
+func (w *writer) close() {
+	w.once.Do(func() {
+		w.mu.Lock()
+		w.closed = true
+		w.mu.Unlock()
+		close(w.quit)
+	})
+	<-w.done
+}
@@ -0,0 +1,61 @@
+package uzbl
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type slowWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(b)
+}
+
+// TestWriterCloseDropsNothing checks that every line accepted by send
+// is written, even if it is sent while the writer is being closed.
+func TestWriterCloseDropsNothing(t *testing.T) {
+	sw := &slowWriter{}
+	w := newWriter(sw)
+
+	var mu sync.Mutex
+	accepted := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				if err := w.send(fmt.Sprintf("cmd %d %d", i, j)); err != nil {
+					if err != ErrClosed {
+						t.Errorf("got %v, want %v", err, ErrClosed)
+					}
+					return
+				}
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	time.Sleep(5 * time.Millisecond)
+	w.close()
+	wg.Wait()
+
+	written := strings.Count(sw.buf.String(), "\n")
+	if written != accepted {
+		t.Errorf("%d lines accepted, but %d written", accepted, written)
+	}
+	if err := w.send("late"); err != ErrClosed {
+		t.Errorf("send after close: got %v, want %v", err, ErrClosed)
+	}
+}